@@ -2,19 +2,33 @@ package main
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"regexp"
+	"strings"
+	"sync"
 	"time"
 
-	"github.com/grafana/grafana-plugin-model/go/datasource"
-	hclog "github.com/hashicorp/go-hclog"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
 
-	"github.com/aws/aws-sdk-go-v2/aws/external"
 	"github.com/aws/aws-sdk-go-v2/service/athena"
+	"github.com/aws/aws-sdk-go-v2/service/athena/types"
 )
 
+// preparedStatementPattern matches the names athena allows for prepared statements
+var preparedStatementPattern = regexp.MustCompile(`^[A-Za-z0-9_]{1,256}$`)
+
 //IAwsAthenaQueryHandler ...
 type IAwsAthenaQueryHandler interface {
 	HandleQuery(ctx context.Context, opt *AthenaDatasourceQueryOption) (*AthenaQueryResult, error)
+	CheckHealth(ctx context.Context, opt *AthenaDatasourceQueryOption) *backend.CheckHealthResult
+	ListCatalogs(ctx context.Context, opt *AthenaDatasourceQueryOption) ([]string, error)
+	ListDatabases(ctx context.Context, opt *AthenaDatasourceQueryOption, catalog string) ([]string, error)
+	ListTables(ctx context.Context, opt *AthenaDatasourceQueryOption, catalog string, database string) ([]string, error)
+	ListColumns(ctx context.Context, opt *AthenaDatasourceQueryOption, catalog string, database string, table string) ([]TableColumn, error)
+	ListPreparedStatements(ctx context.Context, opt *AthenaDatasourceQueryOption) ([]string, error)
 }
 
 //QueryCacheInfo ...
@@ -26,9 +40,12 @@ type QueryCacheInfo struct {
 
 //AwsAthenaQueryHandler ...
 type AwsAthenaQueryHandler struct {
-	logger hclog.Logger
+	logger log.Logger
 	// cache of NamedQueryID to cache Info
 	cache map[string]*QueryCacheInfo
+	// cache of catalog listings for autocomplete
+	resourceCache map[string]*ResourceCacheInfo
+	cacheLock     sync.Mutex
 }
 
 //HandleQuery handle athena query from grafana
@@ -36,30 +53,29 @@ func (handler *AwsAthenaQueryHandler) HandleQuery(ctx context.Context, opt *Athe
 	handler.logger.Debug("HandleQuery Query opt : ", opt)
 	defer handler.cleanCache()
 
-	creds, err := GetCredentials(opt)
+	cfg, err := GetAwsConfig(ctx, opt)
 	if err != nil {
 		return nil, err
 	}
-	cfg, err := external.LoadDefaultAWSConfig()
-	if err != nil {
-		return nil, err
-	}
-	if creds != nil {
-		cfg.Credentials = creds
-		// uses default creds if none provided in opts
-	}
-	cfg.Region = opt.Region
-	client := athena.New(cfg)
+	client := athena.NewFromConfig(cfg)
 
 	switch opt.QueryType {
 	case NamedQuery:
 		return handler.handleNamedQuery(ctx, opt, client)
 	case ExecutionQuery:
 		return handler.handleExecutionQuery(ctx, opt, client)
+	case RawQuery:
+		return handler.handleRawQuery(ctx, opt, client)
+	case PreparedStatement:
+		return handler.handlePreparedStatementQuery(ctx, opt, client)
+	case Builder:
+		return handler.handleBuilderQuery(ctx, opt, client)
 	case GetNamedQueryMetrics:
 		return handler.handleGetNamedQueryMetricsQuery(ctx, opt, client)
+	case NoQuery:
+		return handler.handleNoQuery(opt), nil
 	default:
-		return handler.handleTestQuery(ctx, opt, client)
+		return nil, fmt.Errorf("Unexpected query type %s", opt.QueryType)
 	}
 }
 
@@ -71,6 +87,14 @@ func (handler *AwsAthenaQueryHandler) isValidNamedQuery(opt *AthenaDatasourceQue
 	return opt.NamedQuery != "" && opt.WorkGroup != ""
 }
 
+func (handler *AwsAthenaQueryHandler) isValidRawQuery(opt *AthenaDatasourceQueryOption) bool {
+	return strings.TrimSpace(opt.QueryString) != "" && opt.WorkGroup != ""
+}
+
+func (handler *AwsAthenaQueryHandler) isValidPreparedStatement(opt *AthenaDatasourceQueryOption) bool {
+	return preparedStatementPattern.MatchString(opt.PreparedStatement) && opt.WorkGroup != ""
+}
+
 func (handler *AwsAthenaQueryHandler) handleGetNamedQueryMetricsQuery(ctx context.Context, opt *AthenaDatasourceQueryOption, athenaSvc *athena.Client) (*AthenaQueryResult, error) {
 	handler.logger.Debug("handleGetNamedQueryMetricsQuery opt : ", opt)
 
@@ -83,11 +107,11 @@ func (handler *AwsAthenaQueryHandler) handleGetNamedQueryMetricsQuery(ctx contex
 	result.Opt = opt
 	result.ColumnInfoMap = make(map[int]*ColumnInfo)
 	result.ColumnInfoMap[0] = &ColumnInfo{
-		Type:       datasource.RowValue_TYPE_STRING,
+		Type:       ColumnKindString,
 		ColumnName: "text",
 	}
 	result.ColumnInfoMap[1] = &ColumnInfo{
-		Type:       datasource.RowValue_TYPE_STRING,
+		Type:       ColumnKindString,
 		ColumnName: "value",
 	}
 	result.Rows = make([][]string, 0)
@@ -99,21 +123,13 @@ func (handler *AwsAthenaQueryHandler) handleGetNamedQueryMetricsQuery(ctx contex
 	return result, nil
 }
 
-func (handler *AwsAthenaQueryHandler) handleTestQuery(ctx context.Context, opt *AthenaDatasourceQueryOption, athenaSvc *athena.Client) (*AthenaQueryResult, error) {
-	handler.logger.Debug("handleTestQuery opt : ", opt)
-	// try to call some athena request
-	listNamedQueryReq := athenaSvc.ListNamedQueriesRequest(&athena.ListNamedQueriesInput{
-		WorkGroup: &opt.WorkGroup,
-	})
-	_, err := listNamedQueryReq.Send(ctx)
-	if err != nil {
-		return nil, err
-	}
+// handleNoQuery answers queries without a query type selected yet with an empty result
+func (handler *AwsAthenaQueryHandler) handleNoQuery(opt *AthenaDatasourceQueryOption) *AthenaQueryResult {
 	result := &AthenaQueryResult{}
 	result.Opt = opt
 	result.ColumnInfoMap = make(map[int]*ColumnInfo)
 	result.Rows = make([][]string, 0)
-	return result, nil
+	return result
 }
 
 func (handler *AwsAthenaQueryHandler) handleExecutionQuery(ctx context.Context, opt *AthenaDatasourceQueryOption, athenaSvc *athena.Client) (*AthenaQueryResult, error) {
@@ -121,7 +137,12 @@ func (handler *AwsAthenaQueryHandler) handleExecutionQuery(ctx context.Context,
 	if !handler.isValidExecutionQuery(opt) {
 		return nil, fmt.Errorf("Error. Invalid Execution Query")
 	}
-	return handler.retrieveExecResult(ctx, opt, &opt.ExecutionID, athenaSvc)
+	result, err := handler.retrieveExecResult(ctx, opt, &opt.ExecutionID, athenaSvc)
+	if err != nil {
+		return nil, err
+	}
+	handler.describeExecution(ctx, result, &opt.ExecutionID, false, athenaSvc)
+	return result, nil
 }
 
 func (handler *AwsAthenaQueryHandler) handleNamedQuery(ctx context.Context, opt *AthenaDatasourceQueryOption, athenaSvc *athena.Client) (*AthenaQueryResult, error) {
@@ -134,117 +155,278 @@ func (handler *AwsAthenaQueryHandler) handleNamedQuery(ctx context.Context, opt
 	if err != nil {
 		return nil, err
 	}
-	targetNamedQuery := find(&namedQueries, func(q athena.NamedQuery) bool {
+	targetNamedQuery := find(&namedQueries, func(q types.NamedQuery) bool {
 		return *q.Name == opt.NamedQuery && *q.WorkGroup == opt.WorkGroup
 	})
 	if targetNamedQuery == nil {
 		return nil, fmt.Errorf("Error. Named Query not found")
 	}
+	// named queries are saved with a database, used unless the query selects one
+	if opt.Database == "" && targetNamedQuery.Database != nil {
+		opt.Database = *targetNamedQuery.Database
+	}
+
+	queryString, err := prepareQueryString(*targetNamedQuery.QueryString, opt)
+	if err != nil {
+		return nil, err
+	}
+	cacheKey := *targetNamedQuery.NamedQueryId
+	if queryString != *targetNamedQuery.QueryString {
+		cacheKey += ":" + rawQueryCacheKey(opt.WorkGroup, queryString)
+	}
+
+	return handler.runQuery(ctx, cacheKey, *targetNamedQuery.Name, queryString, opt, athenaSvc)
+}
+
+func (handler *AwsAthenaQueryHandler) handleRawQuery(ctx context.Context, opt *AthenaDatasourceQueryOption, athenaSvc *athena.Client) (*AthenaQueryResult, error) {
+	handler.logger.Debug("handleRawQuery opt : ", opt)
+
+	if !handler.isValidRawQuery(opt) {
+		return nil, fmt.Errorf("Error. Invalid Raw Query")
+	}
+	queryString, err := prepareQueryString(opt.QueryString, opt)
+	if err != nil {
+		return nil, err
+	}
+	return handler.runQuery(ctx, rawQueryCacheKey(opt.WorkGroup, queryString), opt.RefID, queryString, opt, athenaSvc)
+}
+
+func (handler *AwsAthenaQueryHandler) handlePreparedStatementQuery(ctx context.Context, opt *AthenaDatasourceQueryOption, athenaSvc *athena.Client) (*AthenaQueryResult, error) {
+	handler.logger.Debug("handlePreparedStatementQuery opt : ", opt)
+
+	if !handler.isValidPreparedStatement(opt) {
+		return nil, fmt.Errorf("Error. Invalid Prepared Statement")
+	}
+	parameters, err := executionParameters(opt)
+	if err != nil {
+		return nil, err
+	}
+	queryString := "EXECUTE " + opt.PreparedStatement
+	if len(parameters) > 0 {
+		queryString += " USING " + strings.Join(parameters, ", ")
+	}
+	// the parameters are part of the statement, athena rejects them twice
+	stmtOpt := *opt
+	stmtOpt.Parameters = nil
+	return handler.runQuery(ctx, rawQueryCacheKey(opt.WorkGroup, queryString), opt.PreparedStatement, queryString, &stmtOpt, athenaSvc)
+}
+
+func (handler *AwsAthenaQueryHandler) handleBuilderQuery(ctx context.Context, opt *AthenaDatasourceQueryOption, athenaSvc *athena.Client) (*AthenaQueryResult, error) {
+	handler.logger.Debug("handleBuilderQuery opt : ", opt)
+
+	if opt.WorkGroup == "" {
+		return nil, fmt.Errorf("Error. Invalid Builder Query")
+	}
+	queryString, err := compileBuilderQuery(opt.Builder, opt)
+	if err != nil {
+		return nil, err
+	}
+	return handler.runQuery(ctx, rawQueryCacheKey(opt.WorkGroup, queryString), opt.RefID, queryString, opt, athenaSvc)
+}
+
+// runQuery executes queryString in the workgroup of opt, reusing the cached execution of cacheKey if allowed
+func (handler *AwsAthenaQueryHandler) runQuery(ctx context.Context, cacheKey string, queryName string, queryString string, opt *AthenaDatasourceQueryOption, athenaSvc *athena.Client) (*AthenaQueryResult, error) {
+	// the cache is shared by all datasources of the plugin, which may use other accounts or regions
+	cacheKey = opt.DatasourceUID + "/" + opt.Region + "/" + cacheKey
+	// the same sql gives different results in another catalog or database
+	if catalog, database := executionCatalog(opt), executionDatabase(opt); catalog != "" || database != "" {
+		cacheKey += "@" + catalog + "." + database
+	}
+	parameters, err := executionParameters(opt)
+	if err != nil {
+		return nil, err
+	}
+	if len(parameters) > 0 {
+		cacheKey += "?" + rawQueryCacheKey(opt.WorkGroup, strings.Join(parameters, "\x00"))
+	}
 
 	// use cache results if exist and not expired and useCache
-	if cacheInfo, ok := handler.cache[*targetNamedQuery.NamedQueryId]; ok {
+	handler.cacheLock.Lock()
+	cacheInfo, ok := handler.cache[cacheKey]
+	handler.cacheLock.Unlock()
+	if ok {
 		handler.logger.Debug("Cache found...")
 		if opt.UseCache && !cacheInfo.IsExpired() {
 			handler.logger.Debug("Not expired, using cache...")
-			return handler.retrieveExecResult(ctx, opt, &cacheInfo.ExecResultID, athenaSvc)
+			result, err := handler.retrieveExecResult(ctx, opt, &cacheInfo.ExecResultID, athenaSvc)
+			if err == nil {
+				handler.describeExecution(ctx, result, &cacheInfo.ExecResultID, true, athenaSvc)
+				return result, nil
+			}
+			// results may have expired from the output location, the query runs again
+			handler.logger.Warn("Failed to read cached results, firing new request..", "executionId", cacheInfo.ExecResultID, "error", err)
+			handler.cacheLock.Lock()
+			delete(handler.cache, cacheKey)
+			handler.cacheLock.Unlock()
+		} else {
+			handler.logger.Debug("Cache Expired or explicitly skip cache, firing new request..")
 		}
-		handler.logger.Debug("Cache Expired or explicitly skip cache, firing new request..")
 	}
 
 	// get work group info
-	getWorkGrpReq := athenaSvc.GetWorkGroupRequest(&athena.GetWorkGroupInput{
-		WorkGroup: targetNamedQuery.WorkGroup,
+	getWorkGrpRes, err := athenaSvc.GetWorkGroup(ctx, &athena.GetWorkGroupInput{
+		WorkGroup: &opt.WorkGroup,
 	})
-	getWorkGrpRes, err := getWorkGrpReq.Send(ctx)
 	if err != nil {
 		return nil, err
 	}
 	handler.logger.Debug("res ", getWorkGrpRes)
 
-	if getWorkGrpRes.WorkGroup.Configuration.ResultConfiguration.OutputLocation == nil {
+	if conf := getWorkGrpRes.WorkGroup.Configuration; conf == nil || conf.ResultConfiguration == nil || conf.ResultConfiguration.OutputLocation == nil {
 		return nil, fmt.Errorf("Error. Please configure output location for workgroup %s", opt.WorkGroup)
 	}
 
-	return handler.execQuery(ctx, targetNamedQuery, getWorkGrpRes.WorkGroup, opt, athenaSvc)
+	return handler.execQuery(ctx, cacheKey, queryName, queryString, parameters, getWorkGrpRes.WorkGroup, opt, athenaSvc)
 }
 
-func (handler *AwsAthenaQueryHandler) execQuery(ctx context.Context, targetNamedQuery *athena.NamedQuery, workGrp *athena.WorkGroup, opt *AthenaDatasourceQueryOption, athenaSvc *athena.Client) (*AthenaQueryResult, error) {
+func (handler *AwsAthenaQueryHandler) execQuery(ctx context.Context, cacheKey string, queryName string, queryString string, parameters []string, workGrp *types.WorkGroup, opt *AthenaDatasourceQueryOption, athenaSvc *athena.Client) (*AthenaQueryResult, error) {
 	handler.logger.Debug("Start execQuery..")
 	// exec named query
-	execNamedQueryReq := athenaSvc.StartQueryExecutionRequest(&athena.StartQueryExecutionInput{
-		QueryString:         targetNamedQuery.QueryString,
-		WorkGroup:           targetNamedQuery.WorkGroup,
-		ResultConfiguration: workGrp.Configuration.ResultConfiguration,
+	execNamedQueryRes, err := athenaSvc.StartQueryExecution(ctx, &athena.StartQueryExecutionInput{
+		QueryString:           &queryString,
+		WorkGroup:             &opt.WorkGroup,
+		ResultConfiguration:   workGrp.Configuration.ResultConfiguration,
+		QueryExecutionContext: queryExecutionContext(opt),
+		ExecutionParameters:   parameters,
 	})
-	execNamedQueryRes, err := execNamedQueryReq.Send(ctx)
 	if err != nil {
 		return nil, err
 	}
 	handler.logger.Debug("res ", execNamedQueryRes)
-	// wait for result to be ready
-	ch := make(chan athena.QueryExecutionState)
-	go func(ch chan athena.QueryExecutionState) {
-		state := athena.QueryExecutionStateFailed
-		for i := 0; i < int(RequestTimeout/RequestInterval); i++ {
-			handler.logger.Debug("Waiting...")
-			time.Sleep(RequestInterval)
-			getExecResultReq := athenaSvc.GetQueryExecutionRequest(&athena.GetQueryExecutionInput{
-				QueryExecutionId: execNamedQueryRes.QueryExecutionId,
-			})
-			getExecResultRes, err := getExecResultReq.Send(ctx)
-			if err != nil {
-				break
-			}
-			state = getExecResultRes.QueryExecution.Status.State
-			if state == athena.QueryExecutionStateSucceeded ||
-				state == athena.QueryExecutionStateFailed ||
-				state == athena.QueryExecutionStateCancelled {
-				break
-			}
-		}
-		ch <- state
-	}(ch)
-	execState := <-ch
+	// wait for result to be ready, within the query timeout and the deadline of the request
+	timeout := RequestTimeout
+	if opt.QueryTimeout > 0 {
+		timeout = time.Duration(opt.QueryTimeout) * time.Second
+	}
+	waitCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	execution, err := handler.waitForQueryExecution(waitCtx, execNamedQueryRes.QueryExecutionId, opt.MaxBytesScanned, athenaSvc)
+	if err != nil {
+		handler.stopQueryExecution(execNamedQueryRes.QueryExecutionId, athenaSvc)
+		return nil, fmt.Errorf("Error executing request.. %v", err)
+	}
+	execState := execution.Status.State
 	handler.logger.Debug("execState ", execState)
-	if execState != athena.QueryExecutionStateSucceeded {
+	if execState != types.QueryExecutionStateSucceeded {
+		if reason := execution.Status.StateChangeReason; reason != nil {
+			return nil, fmt.Errorf("Error executing request.. ExecState is %v: %s", execState, *reason)
+		}
 		return nil, fmt.Errorf("Error executing request.. ExecState is %v", execState)
 	}
 	// cache execution ID
-	handler.cache[*targetNamedQuery.NamedQueryId] = &QueryCacheInfo{
-		QueryName:      *targetNamedQuery.Name,
+	handler.cacheLock.Lock()
+	handler.cache[cacheKey] = &QueryCacheInfo{
+		QueryName:      queryName,
 		ExecResultID:   *execNamedQueryRes.QueryExecutionId,
 		ExpirationTime: time.Now().Add(CacheExpiryTime),
 	}
+	handler.cacheLock.Unlock()
 
-	return handler.retrieveExecResult(ctx, opt, execNamedQueryRes.QueryExecutionId, athenaSvc)
+	result, err := handler.retrieveExecResult(ctx, opt, execNamedQueryRes.QueryExecutionId, athenaSvc)
+	if err != nil {
+		return nil, err
+	}
+	result.Stats = newExecutionStats(execution, false, opt.PricePerTB)
+	return result, nil
+}
+
+// waitForQueryExecution polls the query execution until it finishes, ctx is done or it scanned more than maxBytesScanned
+func (handler *AwsAthenaQueryHandler) waitForQueryExecution(ctx context.Context, queryExecutionID *string, maxBytesScanned int64, athenaSvc *athena.Client) (*types.QueryExecution, error) {
+	ticker := time.NewTicker(RequestInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+		handler.logger.Debug("Waiting...")
+		getExecResultRes, err := athenaSvc.GetQueryExecution(ctx, &athena.GetQueryExecutionInput{
+			QueryExecutionId: queryExecutionID,
+		})
+		if err != nil {
+			return nil, err
+		}
+		state := getExecResultRes.QueryExecution.Status.State
+		if state == types.QueryExecutionStateSucceeded ||
+			state == types.QueryExecutionStateFailed ||
+			state == types.QueryExecutionStateCancelled {
+			return getExecResultRes.QueryExecution, nil
+		}
+		if stats := getExecResultRes.QueryExecution.Statistics; maxBytesScanned > 0 && stats != nil &&
+			stats.DataScannedInBytes != nil && *stats.DataScannedInBytes > maxBytesScanned {
+			return nil, fmt.Errorf("query scanned %d bytes, more than the limit of %d bytes of the datasource", *stats.DataScannedInBytes, maxBytesScanned)
+		}
+	}
+}
+
+// stopQueryExecution cancels a query that is no longer waited for, so that it does not keep scanning data
+func (handler *AwsAthenaQueryHandler) stopQueryExecution(queryExecutionID *string, athenaSvc *athena.Client) {
+	ctx, cancel := context.WithTimeout(context.Background(), StopQueryTimeout)
+	defer cancel()
+	_, err := athenaSvc.StopQueryExecution(ctx, &athena.StopQueryExecutionInput{
+		QueryExecutionId: queryExecutionID,
+	})
+	if err != nil {
+		handler.logger.Warn("Failed to stop query execution", "executionId", *queryExecutionID, "error", err)
+	}
 }
 
 func (handler *AwsAthenaQueryHandler) retrieveExecResult(ctx context.Context, opt *AthenaDatasourceQueryOption, queryExecutionID *string, athenaSvc *athena.Client) (*AthenaQueryResult, error) {
 	handler.logger.Debug("Start retrieveExecResult..")
-	getQueryResultReq := athenaSvc.GetQueryResultsRequest(&athena.GetQueryResultsInput{
+	// pages hold up to 1000 rows, the header row comes first on the first page
+	resultSet := &types.ResultSet{}
+	truncated := false
+	paginator := athena.NewGetQueryResultsPaginator(athenaSvc, &athena.GetQueryResultsInput{
 		QueryExecutionId: queryExecutionID,
 	})
-
-	getQueryResultRes, err := getQueryResultReq.Send(ctx)
-	if err != nil {
-		return nil, err
+	for paginator.HasMorePages() {
+		if len(resultSet.Rows) > MaxResultRows {
+			truncated = true
+			break
+		}
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if page.ResultSet == nil {
+			break
+		}
+		if resultSet.ResultSetMetadata == nil {
+			resultSet.ResultSetMetadata = page.ResultSet.ResultSetMetadata
+		}
+		resultSet.Rows = append(resultSet.Rows, page.ResultSet.Rows...)
 	}
-	handler.logger.Debug("res ", getQueryResultRes)
+	if len(resultSet.Rows) > MaxResultRows+1 {
+		resultSet.Rows = resultSet.Rows[:MaxResultRows+1]
+		truncated = true
+	}
+	handler.logger.Debug("retrieveExecResult", "rows", len(resultSet.Rows), "truncated", truncated)
 
-	return handler.parseResultSet(opt, getQueryResultRes.ResultSet), nil
+	result := handler.parseResultSet(opt, resultSet)
+	result.Truncated = truncated
+	return result, nil
 }
 
-func (handler *AwsAthenaQueryHandler) parseResultSet(opt *AthenaDatasourceQueryOption, resultSet *athena.ResultSet) *AthenaQueryResult {
+func (handler *AwsAthenaQueryHandler) parseResultSet(opt *AthenaDatasourceQueryOption, resultSet *types.ResultSet) *AthenaQueryResult {
 	result := &AthenaQueryResult{}
 	result.Opt = opt
 	result.ColumnInfoMap = make(map[int]*ColumnInfo)
 	result.Rows = make([][]string, 0)
 
 	// parse response
+	if resultSet.ResultSetMetadata == nil {
+		return result
+	}
 	for i, info := range resultSet.ResultSetMetadata.ColumnInfo {
 		result.ColumnInfoMap[i] = &ColumnInfo{
 			ColumnName: *info.Name,
 			Type:       athenaToGrafanaType(*info.Type),
+			TypeName:   *info.Type,
+			Precision:  int64(info.Precision),
+			Scale:      int64(info.Scale),
+			Nullable:   info.Nullable != types.ColumnNullableNotNull,
+			IsTime:     isAthenaTimeType(*info.Type) || *info.Name == opt.TimeColumn,
 		}
 	}
 	if len(resultSet.Rows) > 1 {
@@ -252,7 +434,12 @@ func (handler *AwsAthenaQueryHandler) parseResultSet(opt *AthenaDatasourceQueryO
 		for i, row := range resultSet.Rows[1:] {
 			result.Rows = append(result.Rows, make([]string, 0))
 			for _, data := range row.Data {
-				result.Rows[i] = append(result.Rows[i], *data.VarCharValue)
+				// null values are returned without a value
+				value := ""
+				if data.VarCharValue != nil {
+					value = *data.VarCharValue
+				}
+				result.Rows[i] = append(result.Rows[i], value)
 			}
 		}
 	}
@@ -260,12 +447,69 @@ func (handler *AwsAthenaQueryHandler) parseResultSet(opt *AthenaDatasourceQueryO
 	return result
 }
 
+// describeExecution adds the statistics of the execution a result was read from, the result is usable without them
+func (handler *AwsAthenaQueryHandler) describeExecution(ctx context.Context, result *AthenaQueryResult, queryExecutionID *string, cacheHit bool, athenaSvc *athena.Client) {
+	getExecRes, err := athenaSvc.GetQueryExecution(ctx, &athena.GetQueryExecutionInput{
+		QueryExecutionId: queryExecutionID,
+	})
+	if err != nil {
+		handler.logger.Debug("describeExecution", "executionId", *queryExecutionID, "error", err)
+		return
+	}
+	result.Stats = newExecutionStats(getExecRes.QueryExecution, cacheHit, result.Opt.PricePerTB)
+	// the execution ran before, reading its results scans nothing
+	result.Stats.EstimatedCost = 0
+}
+
+// newExecutionStats reads the statistics of an athena query execution, the costs are what the execution cost when it ran
+func newExecutionStats(execution *types.QueryExecution, cacheHit bool, pricePerTB float64) *ExecutionStats {
+	stats := &ExecutionStats{CacheHit: cacheHit}
+	if execution == nil {
+		return stats
+	}
+	if execution.QueryExecutionId != nil {
+		stats.ExecutionID = *execution.QueryExecutionId
+	}
+	if execution.Query != nil {
+		stats.Query = *execution.Query
+	}
+	if s := execution.Statistics; s != nil {
+		for _, stat := range []struct {
+			value  *int64
+			target *int64
+		}{
+			{s.DataScannedInBytes, &stats.DataScannedBytes},
+			{s.EngineExecutionTimeInMillis, &stats.EngineExecutionTimeMs},
+			{s.QueryQueueTimeInMillis, &stats.QueryQueueTimeMs},
+			{s.TotalExecutionTimeInMillis, &stats.TotalExecutionTimeMs},
+		} {
+			if stat.value != nil {
+				*stat.target = *stat.value
+			}
+		}
+	}
+	stats.OriginalCost = estimateCost(stats.DataScannedBytes, pricePerTB)
+	stats.EstimatedCost = stats.OriginalCost
+	return stats
+}
+
+// estimateCost prices scanned bytes like athena bills them, rounded up to the megabyte with a 10 MB minimum
+func estimateCost(scannedBytes int64, pricePerTB float64) float64 {
+	billed := (scannedBytes + BilledBytesUnit - 1) / BilledBytesUnit * BilledBytesUnit
+	if billed < BilledBytesMinimum {
+		billed = BilledBytesMinimum
+	}
+	return float64(billed) / BytesPerTB * pricePerTB
+}
+
 // IsExpired ..
 func (info *QueryCacheInfo) IsExpired() bool {
 	return time.Now().After(info.ExpirationTime)
 }
 
 func (handler *AwsAthenaQueryHandler) cleanCache() {
+	handler.cacheLock.Lock()
+	defer handler.cacheLock.Unlock()
 	for k, v := range handler.cache {
 		if v.IsExpired() {
 			delete(handler.cache, k)
@@ -273,28 +517,62 @@ func (handler *AwsAthenaQueryHandler) cleanCache() {
 	}
 }
 
-func (handler *AwsAthenaQueryHandler) getNamedQueries(ctx context.Context, opt *AthenaDatasourceQueryOption, athenaSvc *athena.Client) ([]athena.NamedQuery, error) {
+func (handler *AwsAthenaQueryHandler) getNamedQueries(ctx context.Context, opt *AthenaDatasourceQueryOption, athenaSvc *athena.Client) ([]types.NamedQuery, error) {
 	// get named Ids
-	listNamedQueryReq := athenaSvc.ListNamedQueriesRequest(&athena.ListNamedQueriesInput{
+	listNamedQueryRes, err := athenaSvc.ListNamedQueries(ctx, &athena.ListNamedQueriesInput{
 		WorkGroup: &opt.WorkGroup,
 	})
-	listNamedQueryRes, err := listNamedQueryReq.Send(ctx)
 	if err != nil {
 		return nil, err
 	}
 	handler.logger.Debug("res ", listNamedQueryRes)
 
-	getNamedQueryReq := athenaSvc.BatchGetNamedQueryRequest(&athena.BatchGetNamedQueryInput{
+	getNamedQueryRes, err := athenaSvc.BatchGetNamedQuery(ctx, &athena.BatchGetNamedQueryInput{
 		NamedQueryIds: listNamedQueryRes.NamedQueryIds,
 	})
-	getNamedQueryRes, err := getNamedQueryReq.Send(ctx)
 	if err != nil {
 		return nil, err
 	}
 	return getNamedQueryRes.NamedQueries, nil
 }
 
-func find(namedQueries *[]athena.NamedQuery, fn func(athena.NamedQuery) bool) *athena.NamedQuery {
+// rawQueryCacheKey identifies a raw query by its workgroup and query string
+func rawQueryCacheKey(workGroup string, queryString string) string {
+	hash := sha256.Sum256([]byte(workGroup + "\x00" + queryString))
+	return "raw:" + hex.EncodeToString(hash[:])
+}
+
+// queryExecutionContext returns the catalog and database a query runs in, nil leaves the choice to athena
+func queryExecutionContext(opt *AthenaDatasourceQueryOption) *types.QueryExecutionContext {
+	catalog, database := executionCatalog(opt), executionDatabase(opt)
+	if catalog == "" && database == "" {
+		return nil
+	}
+	execContext := &types.QueryExecutionContext{}
+	if catalog != "" {
+		execContext.Catalog = &catalog
+	}
+	if database != "" {
+		execContext.Database = &database
+	}
+	return execContext
+}
+
+func executionCatalog(opt *AthenaDatasourceQueryOption) string {
+	if catalog := strings.TrimSpace(opt.Catalog); catalog != "" {
+		return catalog
+	}
+	return strings.TrimSpace(opt.DefaultCatalog)
+}
+
+func executionDatabase(opt *AthenaDatasourceQueryOption) string {
+	if database := strings.TrimSpace(opt.Database); database != "" {
+		return database
+	}
+	return strings.TrimSpace(opt.DefaultDatabase)
+}
+
+func find(namedQueries *[]types.NamedQuery, fn func(types.NamedQuery) bool) *types.NamedQuery {
 	for _, q := range *namedQueries {
 		if fn(q) {
 			return &q
@@ -303,15 +581,33 @@ func find(namedQueries *[]athena.NamedQuery, fn func(athena.NamedQuery) bool) *a
 	return nil
 }
 
-func athenaToGrafanaType(athenaType string) datasource.RowValue_Kind {
+func athenaToGrafanaType(athenaType string) ColumnKind {
 	switch athenaType {
 	case "varchar":
-		return datasource.RowValue_TYPE_STRING
-	case "timestamp":
-		return datasource.RowValue_TYPE_INT64
-	case "bigint":
-		return datasource.RowValue_TYPE_INT64
+		return ColumnKindString
+	case "timestamp", "timestamp with time zone", "date":
+		return ColumnKindInt64
+	case "bigint", "integer", "smallint", "tinyint":
+		return ColumnKindInt64
+	case "double", "float", "real", "decimal":
+		return ColumnKindDouble
+	case "boolean":
+		return ColumnKindBool
+	default:
+		return ColumnKindString
+	}
+}
+
+func isAthenaTimeType(athenaType string) bool {
+	switch athenaType {
+	case "timestamp", "timestamp with time zone", "date":
+		return true
 	default:
-		return datasource.RowValue_TYPE_STRING
+		return false
 	}
 }
+
+// IsHighPrecisionDecimal reports whether the column is a decimal that float64 cannot hold exactly
+func (info *ColumnInfo) IsHighPrecisionDecimal() bool {
+	return info.TypeName == "decimal" && info.Precision > DecimalFloatPrecision
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"math"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/athena/types"
+)
+
+func TestEstimateCost(t *testing.T) {
+	tests := []struct {
+		name  string
+		bytes int64
+		want  float64
+	}{
+		{"minimum", 0, 0.00005},
+		{"below minimum", 1000, 0.00005},
+		{"rounded up to the megabyte", 10*1000*1000 + 1, 0.000055},
+		{"terabyte", BytesPerTB, 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := estimateCost(tt.bytes, DefaultPricePerTB); math.Abs(got-tt.want) > 1e-12 {
+				t.Errorf("estimateCost(%d) = %v, want %v", tt.bytes, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewExecutionStats(t *testing.T) {
+	id, query, scanned := "id", "SELECT 1", int64(BytesPerTB)
+	stats := newExecutionStats(&types.QueryExecution{
+		QueryExecutionId: &id,
+		Query:            &query,
+		Statistics:       &types.QueryExecutionStatistics{DataScannedInBytes: &scanned},
+	}, true, DefaultPricePerTB)
+	if stats.ExecutionID != id || stats.Query != query || stats.DataScannedBytes != scanned || !stats.CacheHit {
+		t.Errorf("newExecutionStats = %+v", stats)
+	}
+	if stats.EstimatedCost != 5 || stats.OriginalCost != 5 {
+		t.Errorf("newExecutionStats costs = %v, %v, want 5, 5", stats.EstimatedCost, stats.OriginalCost)
+	}
+	if stats := newExecutionStats(nil, false, DefaultPricePerTB); stats.EstimatedCost != 0 {
+		t.Errorf("newExecutionStats(nil) = %+v", stats)
+	}
+}
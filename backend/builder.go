@@ -0,0 +1,291 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// builderAggregations maps the aggregations of the query builder to athena functions
+var builderAggregations = map[string]string{
+	"sum":             "sum(%s)",
+	"avg":             "avg(%s)",
+	"min":             "min(%s)",
+	"max":             "max(%s)",
+	"count":           "count(%s)",
+	"count_distinct":  "count(DISTINCT %s)",
+	"approx_distinct": "approx_distinct(%s)",
+}
+
+// builderOperators maps the filter operators of the query builder to sql, with the number of values they take
+var builderOperators = map[string]struct {
+	sql    string
+	values int
+}{
+	"=":           {"=", 1},
+	"!=":          {"<>", 1},
+	"<":           {"<", 1},
+	"<=":          {"<=", 1},
+	">":           {">", 1},
+	">=":          {">=", 1},
+	"LIKE":        {"LIKE", 1},
+	"NOT LIKE":    {"NOT LIKE", 1},
+	"IN":          {"IN", -1},
+	"NOT IN":      {"NOT IN", -1},
+	"IS NULL":     {"IS NULL", 0},
+	"IS NOT NULL": {"IS NOT NULL", 0},
+}
+
+// compileBuilderQuery compiles the structured query into athena sql. The time range, partition and
+// ad-hoc filters are rendered by the macros, values are resolved here so they never pass through
+// variable interpolation or macro expansion.
+func compileBuilderQuery(builder *QueryBuilder, opt *AthenaDatasourceQueryOption) (string, error) {
+	if builder == nil || strings.TrimSpace(builder.Table) == "" {
+		return "", fmt.Errorf("Error. Query builder needs a table")
+	}
+	table, err := quoteIdentifier(builder.Table)
+	if err != nil {
+		return "", err
+	}
+
+	selects := make([]string, 0)
+	groupBy := make([]string, 0)
+	where := make([]string, 0)
+	orderBy := make([]string, 0)
+	if builder.TimeColumn != "" {
+		column, err := quoteIdentifier(builder.TimeColumn)
+		if err != nil {
+			return "", err
+		}
+		seconds, err := builderIntervalSeconds(builder.Interval, opt)
+		if err != nil {
+			return "", err
+		}
+		alias := opt.TimeColumn
+		if alias == "" {
+			alias = DefaultTimeColumn
+		}
+		if alias, err = quoteIdentifier(alias); err != nil {
+			return "", err
+		}
+		bucket := fmt.Sprintf("from_unixtime(floor(to_unixtime(%s) / %d) * %d)", column, seconds, seconds)
+		selects = append(selects, bucket+" AS "+alias)
+		groupBy = append(groupBy, bucket)
+		orderBy = append(orderBy, alias)
+		timeFilter, err := timeFilterMacro([]string{column}, opt)
+		if err != nil {
+			return "", err
+		}
+		where = append(where, timeFilter)
+	}
+	for _, name := range builder.GroupBy {
+		column, err := quoteIdentifier(name)
+		if err != nil {
+			return "", err
+		}
+		selects = append(selects, column)
+		groupBy = append(groupBy, column)
+	}
+	aggregated := false
+	plainColumns := make([]string, 0)
+	for _, col := range builder.Columns {
+		expr, isAggregation, err := builderColumnExpr(col)
+		if err != nil {
+			return "", err
+		}
+		aggregated = aggregated || isAggregation
+		selects = append(selects, expr)
+		if !isAggregation {
+			// builderColumnExpr accepted the column, it is a valid identifier
+			column, _ := quoteIdentifier(col.Column)
+			plainColumns = append(plainColumns, column)
+		}
+	}
+	if aggregated {
+		// columns selected next to aggregations must be grouped by
+		for _, column := range plainColumns {
+			if !containsString(groupBy, column) {
+				groupBy = append(groupBy, column)
+			}
+		}
+	}
+	if len(selects) == 0 {
+		selects = append(selects, "*")
+	}
+
+	if strings.TrimSpace(builder.PartitionColumns) != "" {
+		args, err := interpolateMacroArgs(builder.PartitionColumns, opt.Variables)
+		if err != nil {
+			return "", err
+		}
+		partitionFilter, err := partitionFilterMacro(macroArgs(args), opt)
+		if err != nil {
+			return "", err
+		}
+		where = append(where, partitionFilter)
+	}
+	for _, filter := range builder.Filters {
+		condition, err := builderFilterCondition(filter, opt)
+		if err != nil {
+			return "", err
+		}
+		where = append(where, condition)
+	}
+	adhocFilters, err := adhocFilterCondition(opt.AdhocFilters)
+	if err != nil {
+		return "", err
+	}
+	if adhocFilters != "" {
+		where = append(where, adhocFilters)
+	}
+
+	if len(builder.OrderBy) > 0 {
+		orderBy = orderBy[:0]
+		for _, order := range builder.OrderBy {
+			column, err := quoteIdentifier(order.Column)
+			if err != nil {
+				return "", err
+			}
+			if order.Desc {
+				column += " DESC"
+			}
+			orderBy = append(orderBy, column)
+		}
+	}
+
+	var sql strings.Builder
+	sql.WriteString("SELECT " + strings.Join(selects, ", ") + "\nFROM " + table)
+	if len(where) > 0 {
+		sql.WriteString("\nWHERE " + strings.Join(where, " AND "))
+	}
+	if aggregated && len(groupBy) > 0 {
+		sql.WriteString("\nGROUP BY " + strings.Join(groupBy, ", "))
+	}
+	if len(orderBy) > 0 {
+		sql.WriteString("\nORDER BY " + strings.Join(orderBy, ", "))
+	}
+	if builder.Limit > 0 {
+		sql.WriteString("\nLIMIT " + strconv.Itoa(builder.Limit))
+	}
+	return sql.String(), nil
+}
+
+// builderColumnExpr returns the select expression of a column and whether it aggregates
+func builderColumnExpr(col BuilderColumn) (string, bool, error) {
+	aggregation := strings.ToLower(strings.TrimSpace(col.Aggregation))
+	column := "*"
+	if strings.TrimSpace(col.Column) != "*" {
+		quoted, err := quoteIdentifier(col.Column)
+		if err != nil {
+			return "", false, err
+		}
+		column = quoted
+	} else if aggregation != "count" {
+		return "", false, fmt.Errorf("Error. Only count can select *")
+	}
+
+	alias := col.Alias
+	expr := column
+	if aggregation != "" {
+		format, ok := builderAggregations[aggregation]
+		if !ok {
+			return "", false, fmt.Errorf("Error. Unsupported aggregation %s", col.Aggregation)
+		}
+		expr = fmt.Sprintf(format, column)
+		if alias == "" {
+			// names the series of time series, e.g. avg_cpu
+			parts := strings.Split(col.Column, ".")
+			alias = strings.TrimSuffix(aggregation+"_"+strings.TrimSpace(parts[len(parts)-1]), "_*")
+		}
+	}
+	if alias != "" {
+		quoted, err := quoteIdentifier(alias)
+		if err != nil {
+			return "", false, err
+		}
+		expr += " AS " + quoted
+	}
+	return expr, aggregation != "", nil
+}
+
+// builderFilterCondition renders a filter with values of the filter type, a value that is a variable reference
+// takes the values of the variable and $__from or $__to the time range
+func builderFilterCondition(filter BuilderFilter, opt *AthenaDatasourceQueryOption) (string, error) {
+	column, err := quoteIdentifier(filter.Column)
+	if err != nil {
+		return "", err
+	}
+	operator, ok := builderOperators[strings.ToUpper(strings.TrimSpace(filter.Operator))]
+	if !ok {
+		return "", fmt.Errorf("Error. Unsupported filter operator %s", filter.Operator)
+	}
+	if operator.values == 0 {
+		return column + " " + operator.sql, nil
+	}
+
+	value := strings.TrimSpace(filter.Value)
+	literals := make([]string, 0)
+	if groups := variablePattern.FindStringSubmatch(value); groups != nil && groups[0] == value && value != ParameterTimeFrom && value != ParameterTimeTo {
+		name, _ := variableReference(groups)
+		values, ok := opt.Variables[name]
+		if !ok {
+			return "", fmt.Errorf("Error. Unknown variable %s in filter on %s", name, filter.Column)
+		}
+		for _, v := range values {
+			literal, err := formatLiteral(strings.TrimSpace(v), nil, filter.Type)
+			if err != nil {
+				return "", fmt.Errorf("Error. Filter on %s: %v", filter.Column, err)
+			}
+			literals = append(literals, literal)
+		}
+	} else {
+		values := []string{value}
+		if operator.values < 0 {
+			values = strings.Split(value, ",")
+		}
+		for _, v := range values {
+			literal, err := parameterLiteral(QueryParameter{Value: v, Type: filter.Type}, opt)
+			if err != nil {
+				return "", fmt.Errorf("Error. Filter on %s: %v", filter.Column, err)
+			}
+			literals = append(literals, literal)
+		}
+	}
+
+	if operator.values < 0 {
+		if len(literals) == 0 {
+			return "", fmt.Errorf("Error. Filter on %s needs values", filter.Column)
+		}
+		return fmt.Sprintf("%s %s (%s)", column, operator.sql, strings.Join(literals, ", ")), nil
+	}
+	if len(literals) != 1 {
+		return "", fmt.Errorf("Error. Filter on %s takes a single value", filter.Column)
+	}
+	return fmt.Sprintf("%s %s %s", column, operator.sql, literals[0]), nil
+}
+
+// builderIntervalSeconds parses intervals like 30s, 5m or 1d, the query interval is used if empty
+func builderIntervalSeconds(interval string, opt *AthenaDatasourceQueryOption) (int64, error) {
+	interval = strings.TrimSpace(interval)
+	var d time.Duration
+	switch {
+	case interval == "" || interval == "auto":
+		d = time.Duration(opt.IntervalMs) * time.Millisecond
+	case strings.HasSuffix(interval, "d"):
+		days, err := strconv.Atoi(strings.TrimSuffix(interval, "d"))
+		if err != nil {
+			return 0, fmt.Errorf("Error. Invalid interval %s", interval)
+		}
+		d = time.Duration(days) * 24 * time.Hour
+	default:
+		var err error
+		if d, err = time.ParseDuration(interval); err != nil {
+			return 0, fmt.Errorf("Error. Invalid interval %s", interval)
+		}
+	}
+	if d < time.Second {
+		return 1, nil
+	}
+	return int64(d / time.Second), nil
+}
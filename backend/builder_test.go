@@ -0,0 +1,144 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuilderFilterCondition(t *testing.T) {
+	opt := &AthenaDatasourceQueryOption{
+		From:      time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+		Variables: map[string][]string{"hosts": {"web-1", "it's"}, "codes": {"200", "404"}},
+	}
+	tests := []struct {
+		name   string
+		filter BuilderFilter
+		want   string
+		err    string
+	}{
+		{"number looking string", BuilderFilter{Column: "status", Operator: "=", Value: "200"}, `"status" = '200'`, ""},
+		{"number", BuilderFilter{Column: "status", Operator: "=", Value: "200", Type: ParameterTypeNumber}, `"status" = 200`, ""},
+		{"invalid number", BuilderFilter{Column: "status", Operator: "=", Value: "ok", Type: ParameterTypeNumber}, "", "invalid number"},
+		{"string quotes", BuilderFilter{Column: "host", Operator: "!=", Value: "it's"}, `"host" <> 'it''s'`, ""},
+		{"boolean", BuilderFilter{Column: "ok", Operator: "=", Value: "true", Type: ParameterTypeBoolean}, `"ok" = true`, ""},
+		{"time range", BuilderFilter{Column: "ts", Operator: ">=", Value: "$__from", Type: ParameterTypeTimestamp}, `"ts" >= TIMESTAMP '2020-01-01 00:00:00.000'`, ""},
+		{"in list", BuilderFilter{Column: "status", Operator: "IN", Value: "200, 404", Type: ParameterTypeNumber}, `"status" IN (200, 404)`, ""},
+		{"in variable", BuilderFilter{Column: "host", Operator: "in", Value: "$hosts"}, `"host" IN ('web-1', 'it''s')`, ""},
+		{"in number variable", BuilderFilter{Column: "status", Operator: "NOT IN", Value: "${codes}", Type: ParameterTypeNumber}, `"status" NOT IN (200, 404)`, ""},
+		{"multi value variable", BuilderFilter{Column: "host", Operator: "=", Value: "$hosts"}, "", "takes a single value"},
+		{"unknown variable", BuilderFilter{Column: "host", Operator: "=", Value: "$other"}, "", "Unknown variable other"},
+		{"is null", BuilderFilter{Column: "host", Operator: "IS NULL"}, `"host" IS NULL`, ""},
+		{"unsupported operator", BuilderFilter{Column: "host", Operator: "~"}, "", "Unsupported filter operator"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := builderFilterCondition(tt.filter, opt)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("builderFilterCondition error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("builderFilterCondition error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("builderFilterCondition = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompileBuilderQuery(t *testing.T) {
+	opt := &AthenaDatasourceQueryOption{
+		From:         time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+		To:           time.Date(2020, 1, 1, 6, 0, 0, 0, time.UTC),
+		IntervalMs:   60000,
+		AdhocFilters: []AdhocFilter{{Key: "region", Operator: "=", Value: "eu"}},
+	}
+	tests := []struct {
+		name    string
+		builder *QueryBuilder
+		want    string
+		err     string
+	}{
+		{
+			"time series",
+			&QueryBuilder{
+				Table:            "db.metrics",
+				TimeColumn:       "ts",
+				Interval:         "5m",
+				PartitionColumns: "dt:yyyy-MM-dd",
+				Columns:          []BuilderColumn{{Column: "cpu", Aggregation: "avg"}},
+				GroupBy:          []string{"host"},
+				Filters:          []BuilderFilter{{Column: "status", Operator: "=", Value: "200", Type: ParameterTypeNumber}},
+			},
+			`SELECT from_unixtime(floor(to_unixtime("ts") / 300) * 300) AS "time", "host", avg("cpu") AS "avg_cpu"` + "\n" +
+				`FROM "db"."metrics"` + "\n" +
+				`WHERE "ts" BETWEEN TIMESTAMP '2020-01-01 00:00:00.000' AND TIMESTAMP '2020-01-01 06:00:00.000' AND "dt" BETWEEN '2020-01-01' AND '2020-01-01'` +
+				` AND "status" = 200 AND CAST("region" AS varchar) = 'eu'` + "\n" +
+				`GROUP BY from_unixtime(floor(to_unixtime("ts") / 300) * 300), "host"` + "\n" +
+				`ORDER BY "time"`,
+			"",
+		},
+		{
+			"table",
+			&QueryBuilder{
+				Table:   "logs",
+				Columns: []BuilderColumn{{Column: "message"}, {Column: "*", Aggregation: "count", Alias: "n"}},
+				OrderBy: []BuilderOrder{{Column: "n", Desc: true}},
+				Limit:   10,
+			},
+			`SELECT "message", count(*) AS "n"` + "\n" + `FROM "logs"` + "\n" + `WHERE CAST("region" AS varchar) = 'eu'` + "\n" + `GROUP BY "message"` + "\n" + `ORDER BY "n" DESC` + "\n" + `LIMIT 10`,
+			"",
+		},
+		{
+			"columns already grouped",
+			&QueryBuilder{
+				Table:   "logs",
+				Columns: []BuilderColumn{{Column: "host"}, {Column: "level", Alias: "severity"}, {Column: "bytes", Aggregation: "sum"}},
+				GroupBy: []string{"host"},
+			},
+			`SELECT "host", "host", "level" AS "severity", sum("bytes") AS "sum_bytes"` + "\n" + `FROM "logs"` + "\n" + `WHERE CAST("region" AS varchar) = 'eu'` + "\n" + `GROUP BY "host", "level"`,
+			"",
+		},
+		{
+			"columns without aggregation",
+			&QueryBuilder{Table: "logs", Columns: []BuilderColumn{{Column: "host"}, {Column: "level"}}},
+			`SELECT "host", "level"` + "\n" + `FROM "logs"` + "\n" + `WHERE CAST("region" AS varchar) = 'eu'`,
+			"",
+		},
+		{"no table", &QueryBuilder{}, "", "needs a table"},
+		{"star without count", &QueryBuilder{Table: "logs", Columns: []BuilderColumn{{Column: "*", Aggregation: "sum"}}}, "", "Only count can select *"},
+		{"unsupported aggregation", &QueryBuilder{Table: "logs", Columns: []BuilderColumn{{Column: "a", Aggregation: "median"}}}, "", "Unsupported aggregation"},
+		{"invalid interval", &QueryBuilder{Table: "logs", TimeColumn: "ts", Interval: "soon"}, "", "Invalid interval"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := compileBuilderQuery(tt.builder, opt)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("compileBuilderQuery error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("compileBuilderQuery error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("compileBuilderQuery =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuilderIntervalSeconds(t *testing.T) {
+	opt := &AthenaDatasourceQueryOption{IntervalMs: 15000}
+	tests := map[string]int64{"": 15, "auto": 15, "30s": 30, "5m": 300, "1d": 86400, "100ms": 1}
+	for interval, want := range tests {
+		if got, err := builderIntervalSeconds(interval, opt); err != nil || got != want {
+			t.Errorf("builderIntervalSeconds(%q) = %d, %v, want %d", interval, got, err, want)
+		}
+	}
+}
@@ -10,28 +10,174 @@ const (
 // TimestampLayout of athena response
 const TimestampLayout = "2006-01-02 15:04:05"
 
+// DateLayout of athena response
+const DateLayout = "2006-01-02"
+
 // Wait settings
 const (
 	RequestTimeout  = time.Duration(60) * time.Second
 	RequestInterval = time.Duration(500) * time.Millisecond
+	// StopQueryTimeout bounds cancelling a query that timed out
+	StopQueryTimeout = time.Duration(5) * time.Second
 )
 
+// MaxResultRows caps the rows read from the results of an execution, a page holds up to 1000 rows
+const MaxResultRows = 100000
+
 //Cache settings
 const (
 	CacheExpiryTime = time.Duration(12) * time.Hour
+	// ResourceCacheExpiryTime bounds how stale catalog listings may be
+	ResourceCacheExpiryTime = time.Duration(5) * time.Minute
 )
 
+// Athena pricing, bytes are billed by the megabyte with a minimum per query
+const (
+	DefaultPricePerTB  = 5.0
+	BilledBytesMinimum = 10 * 1000 * 1000
+	BilledBytesUnit    = 1000 * 1000
+	BytesPerTB         = 1000 * 1000 * 1000 * 1000
+)
+
+// DefaultCatalog is the athena data catalog backed by glue
+const DefaultCatalog = "AwsDataCatalog"
+
+// Default columns of the query editor
+const (
+	DefaultTimeColumn   = "time"
+	DefaultMetricColumn = "metric"
+)
+
+// Field names of time series frames
+const (
+	TimeFieldName  = "time"
+	ValueFieldName = "value"
+)
+
+// DecimalFloatPrecision is the number of significant digits a float64 holds exactly
+const DecimalFloatPrecision = 15
+
+// Column kind, values match the row value kinds of the former plugin model
+const (
+	ColumnKindNull   ColumnKind = 0
+	ColumnKindDouble ColumnKind = 1
+	ColumnKindInt64  ColumnKind = 2
+	ColumnKindBool   ColumnKind = 3
+	ColumnKindString ColumnKind = 4
+	ColumnKindBytes  ColumnKind = 5
+)
+
+// HealthCheckObjectName is written under the output location to check s3 write access
+const HealthCheckObjectName = ".grafana-athena-health-check"
+
 // Format type
 const (
-	TimeSeries FormatType = "timeseries"
-	Table      FormatType = "table"
+	TimeSeries  FormatType = "timeseries"
+	Table       FormatType = "table"
+	Logs        FormatType = "logs"
+	Annotations FormatType = "annotations"
+	Heatmap     FormatType = "heatmap"
+	Variable    FormatType = "variable"
+)
+
+// Column names of variable queries, the first and second column are used without them
+const (
+	VariableTextColumn  = "__text"
+	VariableValueColumn = "__value"
+)
+
+// Variable format type
+const (
+	VariableFormatNone      VariableFormatType = ""
+	VariableFormatCSV       VariableFormatType = "csv"
+	VariableFormatSQLString VariableFormatType = "sqlstring"
+	VariableFormatRaw       VariableFormatType = "raw"
+	VariableFormatRegex     VariableFormatType = "regex"
 )
 
+// Parameter type, values are formatted as athena literals of the type
+const (
+	ParameterTypeString    ParameterType = ""
+	ParameterTypeNumber    ParameterType = "number"
+	ParameterTypeBoolean   ParameterType = "boolean"
+	ParameterTypeTimestamp ParameterType = "timestamp"
+	ParameterTypeDate      ParameterType = "date"
+)
+
+// Parameter values taken from the time range of the query
+const (
+	ParameterTimeFrom = "$__from"
+	ParameterTimeTo   = "$__to"
+)
+
+// ParameterTimestampLayout of timestamp literals
+const ParameterTimestampLayout = "2006-01-02 15:04:05.000"
+
+// Macro names, written as $__name in queries
+const (
+	MacroAdhocFilters    = "adhocFilters"
+	MacroTimeFilter      = "timeFilter"
+	MacroPartitionFilter = "partitionFilter"
+)
+
+// PartitionFilterMaxValues caps the values listed for a partition column, more are not worth pruning by
+const PartitionFilterMaxValues = 100
+
+// LogLevelColumnName is the column name grafana reads log levels from
+const LogLevelColumnName = "level"
+
+// Aggregation type
+const (
+	AggregationNone  AggregationType = ""
+	AggregationSum   AggregationType = "sum"
+	AggregationAvg   AggregationType = "avg"
+	AggregationMin   AggregationType = "min"
+	AggregationMax   AggregationType = "max"
+	AggregationLast  AggregationType = "last"
+	AggregationCount AggregationType = "count"
+)
+
+// FillMaxPoints caps the points a single series may be filled up to
+const FillMaxPoints = 100000
+
+// Fill mode
+const (
+	FillNone     FillMode = ""
+	FillNull     FillMode = "null"
+	FillZero     FillMode = "zero"
+	FillPrevious FillMode = "previous"
+	FillLinear   FillMode = "linear"
+)
+
+// Downsample type
+const (
+	DownsampleNone DownsampleType = ""
+	DownsampleAvg  DownsampleType = "avg"
+	DownsampleMin  DownsampleType = "min"
+	DownsampleMax  DownsampleType = "max"
+	DownsampleLTTB DownsampleType = "lttb"
+)
+
+// Series sort type
+const (
+	SortByName  SortType = "name"
+	SortByTotal SortType = "total"
+	SortByMax   SortType = "max"
+	SortByLast  SortType = "last"
+)
+
+// OtherSeriesName is the name of the series summing those beyond the limit
+const OtherSeriesName = "other"
+
 // Query Type
 const (
+	NoQuery              QueryType = ""
 	NamedQuery           QueryType = "NamedQuery"
 	ExecutionQuery       QueryType = "ExecutionQuery"
+	RawQuery             QueryType = "RawQuery"
 	GetNamedQueryMetrics QueryType = "GetNamedQueryMetrics"
+	PreparedStatement    QueryType = "PreparedStatement"
+	Builder              QueryType = "Builder"
 )
 
 // Auth Type
@@ -1,19 +1,40 @@
 package main
 
 import (
+	"context"
+
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/aws/external"
-	"github.com/aws/aws-sdk-go-v2/aws/stscreds"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
 	"github.com/aws/aws-sdk-go-v2/service/sts"
 )
 
+// GetAwsConfig loads the default aws config with the region and credentials of the options,
+// default credentials are used if none are provided
+func GetAwsConfig(ctx context.Context, opt *AthenaDatasourceQueryOption) (aws.Config, error) {
+	creds, err := GetCredentials(ctx, opt)
+	if err != nil {
+		return aws.Config{}, err
+	}
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return aws.Config{}, err
+	}
+	if creds != nil {
+		cfg.Credentials = creds
+	}
+	cfg.Region = opt.Region
+	return cfg, nil
+}
+
 //GetCredentials get aws creds thru queryoptions
-func GetCredentials(opt *AthenaDatasourceQueryOption) (aws.CredentialsProvider, error) {
+func GetCredentials(ctx context.Context, opt *AthenaDatasourceQueryOption) (aws.CredentialsProvider, error) {
 	switch opt.AuthType {
 	case Static:
 		return getStaticCreds(opt)
 	case RoleArn:
-		return getRoleCreds(opt)
+		return getRoleCreds(ctx, opt)
 	default:
 		return nil, nil
 	}
@@ -22,20 +43,20 @@ func GetCredentials(opt *AthenaDatasourceQueryOption) (aws.CredentialsProvider,
 func getStaticCreds(opt *AthenaDatasourceQueryOption) (aws.CredentialsProvider, error) {
 	sessionToken := ""
 	if opt.AccessKey != "" && opt.SecretKey != "" {
-		return aws.NewStaticCredentialsProvider(opt.AccessKey, opt.SecretKey, sessionToken), nil
+		return credentials.NewStaticCredentialsProvider(opt.AccessKey, opt.SecretKey, sessionToken), nil
 	}
 	return nil, nil
 }
 
-func getRoleCreds(opt *AthenaDatasourceQueryOption) (aws.CredentialsProvider, error) {
+func getRoleCreds(ctx context.Context, opt *AthenaDatasourceQueryOption) (aws.CredentialsProvider, error) {
 	if opt.RoleARN == "" {
 		return nil, nil
 	}
-	cfg, err := external.LoadDefaultAWSConfig()
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(opt.Region))
 	if err != nil {
 		return nil, err
 	}
-	stsSvc := sts.New(cfg)
+	stsSvc := sts.NewFromConfig(cfg)
 	stsCredProvider := stscreds.NewAssumeRoleProvider(stsSvc, string(opt.RoleARN))
-	return stsCredProvider, nil
+	return aws.NewCredentialsCache(stsCredProvider), nil
 }
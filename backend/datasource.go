@@ -4,140 +4,220 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"regexp"
 	"sort"
 	"strconv"
 	"strings"
 	"time"
 
-	"github.com/grafana/grafana-plugin-model/go/datasource"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
 )
 
-// Query interface
-func (ds *AwsAthenaDatasource) Query(ctx context.Context, req *datasource.DatasourceRequest) (*datasource.DatasourceResponse, error) {
-	ds.logger.Debug("Query Req : %v", req)
-	ds.logger.Debug("Context ctx : %v", ctx)
+var aliasPattern = regexp.MustCompile(`\{\{\s*([\w.-]+)\s*\}\}`)
 
-	opts, err := ds.parseDatasourceRequest(ctx, req)
+// QueryData handles multiple queries and returns multiple responses
+func (ds *AwsAthenaDatasource) QueryData(ctx context.Context, req *backend.QueryDataRequest) (*backend.QueryDataResponse, error) {
+	ds.logger.Debug("QueryData", "queries", len(req.Queries))
+
+	res := backend.NewQueryDataResponse()
+	for _, query := range req.Queries {
+		res.Responses[query.RefID] = ds.handleQuery(ctx, req.PluginContext, query)
+	}
+	return res, nil
+}
+
+// CheckHealth validates the datasource settings against aws
+func (ds *AwsAthenaDatasource) CheckHealth(ctx context.Context, req *backend.CheckHealthRequest) (*backend.CheckHealthResult, error) {
+	opt, err := ds.parseSettings(req.PluginContext)
 	if err != nil {
-		return nil, err
+		return &backend.CheckHealthResult{
+			Status:  backend.HealthStatusError,
+			Message: fmt.Sprintf("Invalid datasource settings: %v", err),
+		}, nil
 	}
-	ds.logger.Debug("opts  : ", opts)
+	return ds.athena.CheckHealth(ctx, opt), nil
+}
 
-	results, err := ds.handleAthenaQuery(ctx, opts)
+func (ds *AwsAthenaDatasource) handleQuery(ctx context.Context, pluginCtx backend.PluginContext, query backend.DataQuery) backend.DataResponse {
+	opt, err := ds.parseQueryOption(pluginCtx, query)
 	if err != nil {
-		return nil, err
+		return backend.DataResponse{Error: err}
 	}
-	ds.logger.Debug("results  : ", results)
+	ds.logger.Debug("opt", "refId", opt.RefID, "queryType", opt.QueryType, "format", opt.Format)
 
-	parsedResults := make([]*datasource.QueryResult, 0)
-	for _, result := range results {
-		parsed, err := ds.parseResult(result)
-		if err != nil {
-			return nil, err
-		}
-		parsedResults = append(parsedResults, parsed)
+	result, err := ds.athena.HandleQuery(ctx, opt)
+	if err != nil {
+		return backend.DataResponse{Error: err}
 	}
-	res := &datasource.DatasourceResponse{
-		Results: parsedResults,
+
+	frames, err := ds.parseResult(result)
+	if err != nil {
+		return backend.DataResponse{Error: err}
 	}
-	ds.logger.Debug("parsed results  : ", res)
-	return res, nil
+	return backend.DataResponse{Frames: frames}
 }
 
-func (ds *AwsAthenaDatasource) parseDatasourceRequest(ctx context.Context, req *datasource.DatasourceRequest) ([]*AthenaDatasourceQueryOption, error) {
-	ds.logger.Debug("parseDataSourceRequest!")
-
-	fromEpochMs := req.TimeRange.GetFromEpochMs()
-	toEpochMs := req.TimeRange.GetToEpochMs()
-	from := time.Unix(fromEpochMs/1000, fromEpochMs%1000*1000*1000)
-	to := time.Unix(toEpochMs/1000, toEpochMs%1000*1000*1000)
+// parseQueryOption merges datasource settings and the query model, the query model json is unchanged from the former plugin model
+func (ds *AwsAthenaDatasource) parseQueryOption(pluginCtx backend.PluginContext, query backend.DataQuery) (*AthenaDatasourceQueryOption, error) {
+	opt, err := ds.parseSettings(pluginCtx)
+	if err != nil {
+		return nil, err
+	}
+	// guardrails are set by the datasource admin, queries cannot lift them
+	maxBytesScanned, pricePerTB, queryTimeout := opt.MaxBytesScanned, opt.PricePerTB, opt.QueryTimeout
+	if err := json.Unmarshal(query.JSON, opt); err != nil {
+		return nil, err
+	}
+	opt.MaxBytesScanned, opt.PricePerTB, opt.QueryTimeout = maxBytesScanned, pricePerTB, queryTimeout
+	opt.RefID = query.RefID
+	opt.From = query.TimeRange.From
+	opt.To = query.TimeRange.To
+	opt.IntervalMs = query.Interval.Milliseconds()
+	opt.MaxDataPoints = query.MaxDataPoints
+	return opt, nil
+}
 
-	opts := make([]*AthenaDatasourceQueryOption, 0)
-	for _, query := range req.Queries {
-		opt := &AthenaDatasourceQueryOption{}
-		opt.SecretKey = req.Datasource.GetDecryptedSecureJsonData()["secretAccessKey"]
-		if err := json.Unmarshal([]byte(req.Datasource.GetJsonData()), &opt); err != nil {
-			return nil, err
+// parseSettings reads the datasource settings into options with the query editor defaults
+func (ds *AwsAthenaDatasource) parseSettings(pluginCtx backend.PluginContext) (*AthenaDatasourceQueryOption, error) {
+	// defaults of the query editor, alerting queries do not pass through the frontend
+	opt := &AthenaDatasourceQueryOption{
+		TimeColumn:   DefaultTimeColumn,
+		MetricColumn: DefaultMetricColumn,
+		UseCache:     true,
+		Format:       TimeSeries,
+		PricePerTB:   DefaultPricePerTB,
+	}
+	if settings := pluginCtx.DataSourceInstanceSettings; settings != nil {
+		opt.SecretKey = settings.DecryptedSecureJSONData["secretAccessKey"]
+		opt.DatasourceUID = settings.UID
+		if opt.DatasourceUID == "" {
+			opt.DatasourceUID = strconv.FormatInt(settings.ID, 10)
 		}
-		if err := json.Unmarshal([]byte(query.ModelJson), &opt); err != nil {
-			return nil, err
+		if len(settings.JSONData) > 0 {
+			if err := json.Unmarshal(settings.JSONData, opt); err != nil {
+				return nil, err
+			}
 		}
-		opt.From = from
-		opt.To = to
-		opts = append(opts, opt)
 	}
-	return opts, nil
+	return opt, nil
 }
 
-func (ds *AwsAthenaDatasource) handleAthenaQuery(ctx context.Context, queryOpts []*AthenaDatasourceQueryOption) ([]*AthenaQueryResult, error) {
-	ds.logger.Debug("handleAthenaQuery!")
-	results := make([]*AthenaQueryResult, 0)
-	for _, opt := range queryOpts {
-		res, err := ds.athena.HandleQuery(ctx, opt)
-		if err != nil {
-			return nil, err
-		}
-		results = append(results, res)
+func (ds *AwsAthenaDatasource) parseResult(result *AthenaQueryResult) (data.Frames, error) {
+	frames, err := ds.parseFrames(result)
+	if err != nil {
+		return nil, err
 	}
-	return results, nil
-}
 
-func (ds *AwsAthenaDatasource) parseResult(result *AthenaQueryResult) (*datasource.QueryResult, error) {
 	// gen metadata
 	colInfos := make([]ColumnInfo, 0)
 	for i := 0; i < len(result.ColumnInfoMap); i++ {
 		colInfos = append(colInfos, *result.ColumnInfoMap[i])
 	}
-	metadata, err := json.Marshal(&QueryResultMetadata{
-		ColumnInfos: colInfos,
-	})
-	if err != nil {
-		return nil, err
+	metadata := &QueryResultMetadata{
+		ColumnInfos:    colInfos,
+		ExecutionStats: result.Stats,
 	}
+	for _, frame := range frames {
+		if frame.Meta == nil {
+			frame.Meta = &data.FrameMeta{}
+		}
+		frame.Meta.Custom = metadata
+		if result.Stats != nil {
+			// shown by the query inspector
+			frame.Meta.ExecutedQueryString = result.Stats.Query
+			frame.Meta.Stats = executionQueryStats(result.Stats)
+		}
+		if result.Truncated {
+			frame.AppendNotices(data.Notice{
+				Severity: data.NoticeSeverityWarning,
+				Text:     fmt.Sprintf("Only the first %d rows of the query result are shown", MaxResultRows),
+			})
+		}
+	}
+	return frames, nil
+}
+
+var costDecimals uint16 = 4
 
-	parsedRes := &datasource.QueryResult{
-		RefId:    result.Opt.RefID,
-		MetaJson: string(metadata),
+// executionQueryStats lists the execution statistics for the stats tab of the query inspector
+func executionQueryStats(stats *ExecutionStats) []data.QueryStat {
+	newStat := func(name string, unit string, value int64) data.QueryStat {
+		return data.QueryStat{
+			FieldConfig: data.FieldConfig{DisplayName: name, Unit: unit},
+			Value:       float64(value),
+		}
 	}
+	newCostStat := func(name string, value float64) data.QueryStat {
+		return data.QueryStat{
+			FieldConfig: data.FieldConfig{DisplayName: name, Unit: "currencyUSD", Decimals: &costDecimals},
+			Value:       value,
+		}
+	}
+	queryStats := []data.QueryStat{
+		newStat("Data scanned", "decbytes", stats.DataScannedBytes),
+		newStat("Engine execution time", "ms", stats.EngineExecutionTimeMs),
+		newStat("Queue time", "ms", stats.QueryQueueTimeMs),
+		newStat("Total execution time", "ms", stats.TotalExecutionTimeMs),
+		newCostStat("Estimated cost", stats.EstimatedCost),
+	}
+	if stats.OriginalCost != stats.EstimatedCost {
+		// results of an earlier execution, e.g. cached
+		queryStats = append(queryStats, newCostStat("Original cost", stats.OriginalCost))
+	}
+	return queryStats
+}
 
+func (ds *AwsAthenaDatasource) parseFrames(result *AthenaQueryResult) (data.Frames, error) {
 	switch result.Opt.Format {
 	case TimeSeries:
 		series, err := ds.parseTimeSeries(result)
 		if err != nil {
 			return nil, err
 		}
-		parsedRes.Series = series
-		return parsedRes, nil
+		if len(series) == 0 {
+			// a well formed numeric frame lets alerting report no data instead of an error
+			return data.Frames{data.NewFrame(result.Opt.RefID,
+				data.NewField(TimeFieldName, nil, []time.Time{}),
+				data.NewField(ValueFieldName, nil, []*float64{}),
+			)}, nil
+		}
+		return seriesToFrames(series), nil
 	case Table:
-		tables, err := ds.parseTable(result)
+		return ds.parseTable(result)
+	case Heatmap:
+		series, err := ds.parseHeatmap(result)
 		if err != nil {
 			return nil, err
 		}
-		parsedRes.Tables = tables
-		return parsedRes, nil
+		return seriesToFrames(series), nil
+	case Annotations:
+		return ds.parseAnnotations(result)
+	case Logs:
+		return ds.parseLogs(result)
+	case Variable:
+		return ds.parseVariable(result)
 	default:
 		return nil, fmt.Errorf("Unexpected format type")
 	}
 }
 
-func (ds *AwsAthenaDatasource) parseTimeSeries(result *AthenaQueryResult) ([]*datasource.TimeSeries, error) {
+func (ds *AwsAthenaDatasource) parseTimeSeries(result *AthenaQueryResult) ([]*Series, error) {
 	opt := result.Opt
-	seriesMap := make(map[string]*datasource.TimeSeries)
+	seriesMap := make(map[string]*Series)
 	valueColumns := make(map[string]bool)
-	for _, valCol := range strings.Split(opt.ValueColumns, ",") {
-		valCol = strings.Trim(valCol, " ")
-		if valCol == "" {
-			continue
-		}
+	for _, valCol := range parseColumnList(opt.ValueColumns) {
 		valueColumns[valCol] = true
 	}
+	labelColumns := parseColumnList(opt.LabelColumns)
 
 	for _, row := range result.Rows {
 		var t time.Time
 		var err error
 		var timestamp int64 = 0
 		var metricVal string = ""
-		tags := make(map[string]string)
+		var skipRow bool = false
+		labels := make(map[string]string)
 		values := make(map[string]float64)
 
 		for colIndex, rowValue := range row {
@@ -146,110 +226,476 @@ func (ds *AwsAthenaDatasource) parseTimeSeries(result *AthenaQueryResult) ([]*da
 
 			switch colName {
 			case opt.TimeColumn:
-				t, err = time.Parse(TimestampLayout, rowValue)
+				if rowValue == "" {
+					// null time, the row cannot be placed on the graph
+					skipRow = true
+					continue
+				}
+				t, err = parseTimestamp(rowValue)
 				if err != nil {
 					return nil, err
 				}
-				timestamp = t.Unix() * 1000
+				timestamp = t.UnixNano() / int64(time.Millisecond)
 			case opt.MetricColumn:
 				metricVal = rowValue
 			default:
-				if !(colInfo.Type == datasource.RowValue_TYPE_DOUBLE || colInfo.Type == datasource.RowValue_TYPE_INT64) {
-					tags[colName] = rowValue
+				if containsString(labelColumns, colName) {
+					labels[colName] = rowValue
+					continue
+				}
+				if !(colInfo.Type == ColumnKindDouble || colInfo.Type == ColumnKindInt64) {
 					continue
 				}
 				if _, ok := valueColumns[colName]; ok || len(valueColumns) == 0 {
-					value, _ := strconv.ParseFloat(rowValue, 64)
-					values[colName] = value
+					// null values are left out rather than graphed as 0
+					if value, err := strconv.ParseFloat(rowValue, 64); err == nil {
+						values[colName] = value
+					}
 					continue
 				}
 			}
 		}
 
-		if !t.IsZero() && (t.Before(opt.From) || t.After(opt.To)) {
+		if skipRow || !t.IsZero() && (t.Before(opt.From) || t.After(opt.To)) {
 			continue
 		}
 		for colName, val := range values {
-			seriesName := formatSeriesName(metricVal, colName)
-			if seriesMap[seriesName] == nil {
-				seriesMap[seriesName] = &datasource.TimeSeries{
-					Name: seriesName,
-					Tags: tags,
+			seriesKey := formatSeriesKey(metricVal, colName, labelColumns, labels)
+			if seriesMap[seriesKey] == nil {
+				// each series owns its labels, rows must not share the map
+				tags := make(map[string]string, len(labels))
+				for k, v := range labels {
+					tags[k] = v
+				}
+				seriesMap[seriesKey] = &Series{
+					Name:   formatSeriesName(opt.Alias, metricVal, colName, labelColumns, labels),
+					Labels: tags,
 				}
 			}
-			seriesMap[seriesName].Points = append(seriesMap[seriesName].Points, &datasource.Point{
+			seriesMap[seriesKey].Points = append(seriesMap[seriesKey].Points, &Point{
 				Timestamp: timestamp,
 				Value:     val,
 			})
 		}
 	}
 
-	series := make([]*datasource.TimeSeries, 0)
+	series := make([]*Series, 0)
 	for _, serie := range seriesMap {
-		sort.Slice(serie.Points, func(i int, j int) bool {
+		// stable so that "last" aggregation follows row order
+		sort.SliceStable(serie.Points, func(i int, j int) bool {
 			return serie.Points[i].Timestamp < serie.Points[j].Timestamp
 		})
+		if opt.Aggregation != AggregationNone {
+			points, err := aggregateDuplicatePoints(serie.Points, opt.Aggregation)
+			if err != nil {
+				return nil, err
+			}
+			serie.Points = points
+		}
+		// gaps are filled at the query interval first, downsampled points are further apart than it
+		if opt.Fill != FillNone {
+			points, err := fillGaps(serie.Points, opt)
+			if err != nil {
+				return nil, err
+			}
+			serie.Points = points
+		}
+		if opt.Downsample != DownsampleNone {
+			points, err := downsample(serie.Points, opt)
+			if err != nil {
+				return nil, err
+			}
+			serie.Points = points
+		}
+		series = append(series, serie)
+	}
+	return sortAndLimitSeries(series, opt)
+}
+
+// parseHeatmap emits one series per bucket bound ordered by bound, counts of a bucket sharing a timestamp are summed.
+// Every bucket gets a point at every timestamp so that the buckets line up.
+func (ds *AwsAthenaDatasource) parseHeatmap(result *AthenaQueryResult) ([]*Series, error) {
+	opt := result.Opt
+	timeIndex, bucketIndex, countIndex := -1, -1, -1
+	for i := 0; i < len(result.ColumnInfoMap); i++ {
+		switch result.ColumnInfoMap[i].ColumnName {
+		case opt.TimeColumn:
+			timeIndex = i
+		case opt.BucketColumn:
+			bucketIndex = i
+		case opt.CountColumn:
+			countIndex = i
+		}
+	}
+	if timeIndex < 0 || bucketIndex < 0 || countIndex < 0 {
+		return nil, fmt.Errorf("Error. Heatmap requires time column %q, bucket column %q and count column %q", opt.TimeColumn, opt.BucketColumn, opt.CountColumn)
+	}
+
+	counts := make(map[string]map[int64]float64)
+	bounds := make(map[string]float64)
+	timestamps := make(map[int64]bool)
+	for _, row := range result.Rows {
+		if row[timeIndex] == "" || row[bucketIndex] == "" || row[countIndex] == "" {
+			// null time, bound or count, the row cannot be placed on the graph
+			continue
+		}
+		t, err := parseTimestamp(row[timeIndex])
+		if err != nil {
+			return nil, err
+		}
+		if t.Before(opt.From) || t.After(opt.To) {
+			continue
+		}
+		bucket := row[bucketIndex]
+		bound, err := strconv.ParseFloat(bucket, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Error. Bucket bound %q is not numeric", bucket)
+		}
+		count, err := strconv.ParseFloat(row[countIndex], 64)
+		if err != nil {
+			return nil, fmt.Errorf("Error. Bucket count %q is not numeric", row[countIndex])
+		}
+		timestamp := t.UnixNano() / int64(time.Millisecond)
+		if counts[bucket] == nil {
+			counts[bucket] = make(map[int64]float64)
+			bounds[bucket] = bound
+		}
+		counts[bucket][timestamp] += count
+		timestamps[timestamp] = true
+	}
+
+	sortedTimestamps := make([]int64, 0, len(timestamps))
+	for ts := range timestamps {
+		sortedTimestamps = append(sortedTimestamps, ts)
+	}
+	sort.Slice(sortedTimestamps, func(i int, j int) bool {
+		return sortedTimestamps[i] < sortedTimestamps[j]
+	})
+	series := make([]*Series, 0, len(counts))
+	for bucket, bucketCounts := range counts {
+		serie := &Series{
+			Name:   bucket,
+			Labels: map[string]string{opt.BucketColumn: bucket},
+			Points: make([]*Point, 0, len(sortedTimestamps)),
+		}
+		for _, ts := range sortedTimestamps {
+			serie.Points = append(serie.Points, &Point{Timestamp: ts, Value: bucketCounts[ts]})
+		}
 		series = append(series, serie)
 	}
+	sort.Slice(series, func(i int, j int) bool {
+		return bounds[series[i].Name] < bounds[series[j].Name]
+	})
 	return series, nil
 }
 
-func formatSeriesName(metricVal string, valueColName string) string {
-	if metricVal == "" {
-		return valueColName
+func formatSeriesName(alias string, metricVal string, valueColName string, labelColumns []string, labels map[string]string) string {
+	if alias != "" {
+		return formatAlias(alias, metricVal, valueColName, labels)
+	}
+	name := valueColName
+	if metricVal != "" {
+		name = metricVal + " " + valueColName
+	}
+	if len(labelColumns) == 0 {
+		return name
+	}
+	return name + " " + formatLabels(labelColumns, labels)
+}
+
+// formatAlias replaces {{metric}}, {{column}} and {{<label name>}} placeholders, unknown ones are kept as is
+func formatAlias(alias string, metricVal string, valueColName string, labels map[string]string) string {
+	return aliasPattern.ReplaceAllStringFunc(alias, func(placeholder string) string {
+		name := aliasPattern.FindStringSubmatch(placeholder)[1]
+		switch name {
+		case "metric":
+			return metricVal
+		case "column":
+			return valueColName
+		}
+		if val, ok := labels[name]; ok {
+			return val
+		}
+		return placeholder
+	})
+}
+
+// formatSeriesKey identifies a series by its metric, value column and labels
+func formatSeriesKey(metricVal string, valueColName string, labelColumns []string, labels map[string]string) string {
+	return metricVal + "\x00" + valueColName + "\x00" + formatLabels(labelColumns, labels)
+}
+
+func formatLabels(labelColumns []string, labels map[string]string) string {
+	pairs := make([]string, 0, len(labelColumns))
+	for _, col := range labelColumns {
+		pairs = append(pairs, col+"="+labels[col])
+	}
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
+
+func parseColumnList(columns string) []string {
+	list := make([]string, 0)
+	for _, col := range strings.Split(columns, ",") {
+		col = strings.Trim(col, " ")
+		if col == "" || containsString(list, col) {
+			continue
+		}
+		list = append(list, col)
+	}
+	return list
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func (ds *AwsAthenaDatasource) parseTable(result *AthenaQueryResult) (data.Frames, error) {
+	frame := data.NewFrame(result.Opt.RefID)
+	for i := 0; i < len(result.ColumnInfoMap); i++ {
+		values := make([]string, 0, len(result.Rows))
+		for _, row := range result.Rows {
+			values = append(values, row[i])
+		}
+		frame.Fields = append(frame.Fields, newColumnField(result.ColumnInfoMap[i], values, result.Opt.PreserveDecimals))
 	}
-	return metricVal + " " + valueColName
+	return data.Frames{frame}, nil
 }
 
-func (ds *AwsAthenaDatasource) parseTable(result *AthenaQueryResult) ([]*datasource.Table, error) {
-	table := datasource.Table{
-		Columns: func(res *AthenaQueryResult) []*datasource.TableColumn {
-			cols := make([]*datasource.TableColumn, 0)
-			for i := 0; i < len(res.ColumnInfoMap); i++ {
-				cols = append(cols, &datasource.TableColumn{
-					Name: res.ColumnInfoMap[i].ColumnName,
-				})
+// parseLogs reorders columns into time, message, level and label columns, newest entries first
+func (ds *AwsAthenaDatasource) parseLogs(result *AthenaQueryResult) (data.Frames, error) {
+	opt := result.Opt
+	timeIndex, messageIndex, levelIndex := -1, -1, -1
+	for i := 0; i < len(result.ColumnInfoMap); i++ {
+		switch result.ColumnInfoMap[i].ColumnName {
+		case opt.TimeColumn:
+			timeIndex = i
+		case opt.MessageColumn:
+			messageIndex = i
+		case opt.LevelColumn:
+			levelIndex = i
+		}
+	}
+	if timeIndex < 0 || messageIndex < 0 {
+		return nil, fmt.Errorf("Error. Logs require time column %q and message column %q", opt.TimeColumn, opt.MessageColumn)
+	}
+	if opt.LevelColumn != "" && levelIndex < 0 {
+		return nil, fmt.Errorf("Error. Level column %q not found", opt.LevelColumn)
+	}
+
+	labelColumns := parseColumnList(opt.LabelColumns)
+	order := []int{timeIndex, messageIndex}
+	if levelIndex >= 0 {
+		order = append(order, levelIndex)
+	}
+	for i := 0; i < len(result.ColumnInfoMap); i++ {
+		name := result.ColumnInfoMap[i].ColumnName
+		if i == timeIndex || i == messageIndex || i == levelIndex {
+			continue
+		}
+		if len(labelColumns) == 0 || containsString(labelColumns, name) {
+			order = append(order, i)
+		}
+	}
+
+	logs := &AthenaQueryResult{
+		ColumnInfoMap: make(map[int]*ColumnInfo),
+		Rows:          make([][]string, 0),
+		Opt:           opt,
+	}
+	for i, colIndex := range order {
+		info := *result.ColumnInfoMap[colIndex]
+		if colIndex == timeIndex {
+			info.IsTime = true
+		}
+		if colIndex == levelIndex {
+			// grafana picks up the log level from a field named level
+			info.ColumnName = LogLevelColumnName
+		}
+		logs.ColumnInfoMap[i] = &info
+	}
+
+	type logEntry struct {
+		t   time.Time
+		row []string
+	}
+	entries := make([]logEntry, 0, len(result.Rows))
+	for _, row := range result.Rows {
+		if row[timeIndex] == "" {
+			// null time, the entry cannot be placed in the logs
+			continue
+		}
+		t, err := parseTimestamp(row[timeIndex])
+		if err != nil {
+			return nil, err
+		}
+		if t.Before(opt.From) || t.After(opt.To) {
+			continue
+		}
+		logRow := make([]string, 0, len(order))
+		for _, colIndex := range order {
+			value := row[colIndex]
+			if colIndex == levelIndex {
+				value = strings.ToLower(value)
 			}
-			return cols
-		}(result),
-		Rows: make([]*datasource.TableRow, 0),
+			logRow = append(logRow, value)
+		}
+		entries = append(entries, logEntry{t: t, row: logRow})
+	}
+	sort.SliceStable(entries, func(i int, j int) bool {
+		return entries[i].t.After(entries[j].t)
+	})
+	for _, entry := range entries {
+		logs.Rows = append(logs.Rows, entry.row)
 	}
 
+	frames, err := ds.parseTable(logs)
+	if err != nil {
+		return nil, err
+	}
+	for _, frame := range frames {
+		frame.Meta = &data.FrameMeta{PreferredVisualization: data.VisTypeLogs}
+	}
+	return frames, nil
+}
+
+// parseAnnotations maps rows into time, timeEnd, title, text and tags columns of events overlapping the time range
+func (ds *AwsAthenaDatasource) parseAnnotations(result *AthenaQueryResult) (data.Frames, error) {
+	opt := result.Opt
+	colIndexes := make(map[string]int)
+	for i := 0; i < len(result.ColumnInfoMap); i++ {
+		colIndexes[result.ColumnInfoMap[i].ColumnName] = i
+	}
+	if _, ok := colIndexes[opt.TimeColumn]; !ok {
+		return nil, fmt.Errorf("Error. Annotations require time column %q", opt.TimeColumn)
+	}
+	for _, col := range []string{opt.TimeEndColumn, opt.TitleColumn, opt.TextColumn, opt.TagsColumn} {
+		if _, ok := colIndexes[col]; col != "" && !ok {
+			return nil, fmt.Errorf("Error. Annotation column %q not found", col)
+		}
+	}
+	valueOf := func(row []string, col string) string {
+		if i, ok := colIndexes[col]; ok && col != "" {
+			return row[i]
+		}
+		return ""
+	}
+
+	annotations := &AthenaQueryResult{
+		ColumnInfoMap: make(map[int]*ColumnInfo),
+		Rows:          make([][]string, 0),
+		Opt:           opt,
+	}
+	for i, name := range []string{"time", "timeEnd", "title", "text", "tags"} {
+		annotations.ColumnInfoMap[i] = &ColumnInfo{
+			Type:       ColumnKindString,
+			ColumnName: name,
+			IsTime:     name == "time" || name == "timeEnd",
+		}
+	}
 	for _, row := range result.Rows {
-		values := make([]*datasource.RowValue, 0)
-		for colIndex, value := range row {
-			info := *result.ColumnInfoMap[colIndex]
-			var intVal int64 = 0
-			var doubleVal float64 = 0.0
-
-			//parse types
-			switch info.Type {
-			case datasource.RowValue_TYPE_INT64:
-				// try parse as time
-				t, err := time.Parse(TimestampLayout, value)
-				if err == nil {
-					intVal = t.Unix() * 1000 // to epoch millis
-				} else {
-					i, err := strconv.Atoi(value)
-					if err == nil {
-						intVal = int64(i)
-					}
-				}
-			case datasource.RowValue_TYPE_DOUBLE:
-				d, err := strconv.ParseFloat(value, 64)
-				if err == nil {
-					doubleVal = d
-				}
+		if valueOf(row, opt.TimeColumn) == "" {
+			// null time, the event cannot be placed on the graph
+			continue
+		}
+		start, err := parseTimestamp(valueOf(row, opt.TimeColumn))
+		if err != nil {
+			return nil, err
+		}
+		end := start
+		if opt.TimeEndColumn != "" {
+			if end, err = parseTimestamp(valueOf(row, opt.TimeEndColumn)); err != nil {
+				end = start
 			}
-			values = append(values, &datasource.RowValue{
-				Kind:        info.Type,
-				Int64Value:  intVal,
-				DoubleValue: doubleVal,
-				StringValue: value,
-			})
 		}
-		table.Rows = append(table.Rows, &datasource.TableRow{Values: values})
+		if start.After(opt.To) || end.Before(opt.From) {
+			continue
+		}
+		annotations.Rows = append(annotations.Rows, []string{
+			start.Format(time.RFC3339Nano),
+			end.Format(time.RFC3339Nano),
+			valueOf(row, opt.TitleColumn),
+			valueOf(row, opt.TextColumn),
+			strings.Join(parseTags(valueOf(row, opt.TagsColumn)), ","),
+		})
 	}
 
-	return []*datasource.Table{&table}, nil
+	return ds.parseTable(annotations)
+}
+
+// parseVariable maps the __text and __value columns, or else the first and second column, to variable options
+func (ds *AwsAthenaDatasource) parseVariable(result *AthenaQueryResult) (data.Frames, error) {
+	texts := make([]string, 0, len(result.Rows))
+	values := make([]string, 0, len(result.Rows))
+	if len(result.ColumnInfoMap) > 0 {
+		textIndex, valueIndex := -1, -1
+		for i := 0; i < len(result.ColumnInfoMap); i++ {
+			switch result.ColumnInfoMap[i].ColumnName {
+			case VariableTextColumn:
+				textIndex = i
+			case VariableValueColumn:
+				valueIndex = i
+			}
+		}
+		switch {
+		case textIndex < 0 && valueIndex < 0:
+			textIndex, valueIndex = 0, 0
+			if len(result.ColumnInfoMap) > 1 {
+				valueIndex = 1
+			}
+		case textIndex < 0:
+			textIndex = valueIndex
+		case valueIndex < 0:
+			valueIndex = textIndex
+		}
+
+		// dashboards show each option once
+		seen := make(map[[2]string]bool)
+		for _, row := range result.Rows {
+			option := [2]string{row[textIndex], row[valueIndex]}
+			if seen[option] {
+				continue
+			}
+			seen[option] = true
+			texts = append(texts, option[0])
+			values = append(values, option[1])
+		}
+	}
+	return data.Frames{data.NewFrame(result.Opt.RefID,
+		newStringField("text", texts),
+		newStringField("value", values),
+	)}, nil
+}
+
+// parseTags splits comma separated tags, athena arrays are returned as [a, b]
+func parseTags(value string) []string {
+	value = strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(value), "["), "]")
+	return parseColumnList(value)
+}
+
+// parseTimestamp parses athena timestamp and date values
+func parseTimestamp(value string) (time.Time, error) {
+	t, err := time.Parse(TimestampLayout, value)
+	if err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(DateLayout, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return t, nil
+	}
+	// timestamp with time zone, e.g. 2020-01-01 00:00:00.000 UTC
+	if i := strings.LastIndex(value, " "); i > 0 {
+		if loc, err := time.LoadLocation(value[i+1:]); err == nil {
+			if t, err := time.ParseInLocation(TimestampLayout, value[:i], loc); err == nil {
+				return t, nil
+			}
+		}
+	}
+	return t, err
 }
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// seriesToFrames converts each series into a frame with a time and a value field
+func seriesToFrames(series []*Series) data.Frames {
+	frames := make(data.Frames, 0, len(series))
+	for _, serie := range series {
+		times := make([]time.Time, 0, len(serie.Points))
+		values := make([]*float64, 0, len(serie.Points))
+		for _, p := range serie.Points {
+			times = append(times, time.Unix(0, p.Timestamp*int64(time.Millisecond)).UTC())
+			if math.IsNaN(p.Value) {
+				// filled null points
+				values = append(values, nil)
+				continue
+			}
+			value := p.Value
+			values = append(values, &value)
+		}
+		valueField := data.NewField(ValueFieldName, data.Labels(serie.Labels), values)
+		valueField.Config = &data.FieldConfig{DisplayNameFromDS: serie.Name}
+		frames = append(frames, data.NewFrame(serie.Name,
+			data.NewField(TimeFieldName, nil, times),
+			valueField,
+		))
+	}
+	return frames
+}
+
+// newColumnField types a result column by its column info, a column with values that do not parse as its kind is kept as strings.
+// Empty values of non string columns are athena nulls.
+func newColumnField(info *ColumnInfo, values []string, preserveDecimals bool) *data.Field {
+	name := info.ColumnName
+	switch {
+	case info.IsTime:
+		times := make([]*time.Time, len(values))
+		for i, value := range values {
+			if value == "" {
+				continue
+			}
+			t, err := parseTimestamp(value)
+			if err != nil {
+				return newStringField(name, values)
+			}
+			times[i] = &t
+		}
+		return data.NewField(name, nil, times)
+	case info.Type == ColumnKindInt64:
+		ints := make([]*int64, len(values))
+		for i, value := range values {
+			if value == "" {
+				continue
+			}
+			v, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return newStringField(name, values)
+			}
+			ints[i] = &v
+		}
+		return data.NewField(name, nil, ints)
+	case info.Type == ColumnKindDouble && !(preserveDecimals && info.IsHighPrecisionDecimal()):
+		// high precision decimals stay exact strings, time series still parse them as floats for graphing
+		floats := make([]*float64, len(values))
+		for i, value := range values {
+			if value == "" {
+				continue
+			}
+			v, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return newStringField(name, values)
+			}
+			floats[i] = &v
+		}
+		return data.NewField(name, nil, floats)
+	case info.Type == ColumnKindBool:
+		bools := make([]*bool, len(values))
+		for i, value := range values {
+			if value == "" {
+				continue
+			}
+			v, err := strconv.ParseBool(value)
+			if err != nil {
+				return newStringField(name, values)
+			}
+			bools[i] = &v
+		}
+		return data.NewField(name, nil, bools)
+	default:
+		return newStringField(name, values)
+	}
+}
+
+func newStringField(name string, values []string) *data.Field {
+	strs := make([]*string, len(values))
+	for i := range values {
+		strs[i] = &values[i]
+	}
+	return data.NewField(name, nil, strs)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/athena"
+	"github.com/aws/aws-sdk-go-v2/service/athena/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+// HealthCheckStep is the outcome of a single health check
+type HealthCheckStep struct {
+	Name    string `json:"name"`
+	OK      bool   `json:"ok"`
+	Message string `json:"message"`
+}
+
+// CheckHealth validates credentials, workgroup, output location and s3 write access in turn,
+// stopping at the first failing step
+func (handler *AwsAthenaQueryHandler) CheckHealth(ctx context.Context, opt *AthenaDatasourceQueryOption) *backend.CheckHealthResult {
+	steps := make([]HealthCheckStep, 0)
+	fail := func(name string, err error, hint string) *backend.CheckHealthResult {
+		steps = append(steps, HealthCheckStep{Name: name, Message: fmt.Sprintf("%v. %s", err, hint)})
+		return newHealthResult(backend.HealthStatusError, steps)
+	}
+
+	cfg, err := GetAwsConfig(ctx, opt)
+	if err != nil {
+		return fail("Credentials", err, "Check the auth type and region settings")
+	}
+
+	identity, err := sts.NewFromConfig(cfg).GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return fail("Credentials", err, "Check the access key, secret key or role ARN")
+	}
+	steps = append(steps, HealthCheckStep{Name: "Credentials", OK: true, Message: "Authenticated as " + *identity.Arn})
+
+	if opt.WorkGroup == "" {
+		return fail("Workgroup", fmt.Errorf("No workgroup configured"), "Set the workgroup in the datasource settings")
+	}
+	workGrpRes, err := athena.NewFromConfig(cfg).GetWorkGroup(ctx, &athena.GetWorkGroupInput{
+		WorkGroup: &opt.WorkGroup,
+	})
+	if err != nil {
+		return fail("Workgroup", err, fmt.Sprintf("Check that workgroup %s exists in %s and athena:GetWorkGroup is allowed", opt.WorkGroup, opt.Region))
+	}
+	if state := workGrpRes.WorkGroup.State; state != types.WorkGroupStateEnabled {
+		return fail("Workgroup", fmt.Errorf("Workgroup %s is %s", opt.WorkGroup, state), "Enable the workgroup in the athena console, queries in a disabled workgroup fail")
+	}
+	steps = append(steps, HealthCheckStep{Name: "Workgroup", OK: true, Message: fmt.Sprintf("Workgroup %s is %s", opt.WorkGroup, workGrpRes.WorkGroup.State)})
+
+	outputLocation := ""
+	if conf := workGrpRes.WorkGroup.Configuration; conf != nil && conf.ResultConfiguration != nil && conf.ResultConfiguration.OutputLocation != nil {
+		outputLocation = *conf.ResultConfiguration.OutputLocation
+	}
+	if outputLocation == "" {
+		return fail("Output location", fmt.Errorf("No query result location for workgroup %s", opt.WorkGroup), "Configure an output location for the workgroup in the athena console")
+	}
+	steps = append(steps, HealthCheckStep{Name: "Output location", OK: true, Message: outputLocation})
+
+	if err := checkS3WriteAccess(ctx, s3.NewFromConfig(cfg), outputLocation); err != nil {
+		return fail("S3 write access", err, fmt.Sprintf("Allow s3:PutObject on %s", outputLocation))
+	}
+	steps = append(steps, HealthCheckStep{Name: "S3 write access", OK: true, Message: "Query results can be written to " + outputLocation})
+
+	return newHealthResult(backend.HealthStatusOk, steps)
+}
+
+// checkS3WriteAccess writes and removes a marker object under the output location
+func checkS3WriteAccess(ctx context.Context, s3Svc *s3.Client, outputLocation string) error {
+	location, err := url.Parse(outputLocation)
+	if err != nil || location.Scheme != "s3" || location.Host == "" {
+		return fmt.Errorf("Invalid output location %s", outputLocation)
+	}
+	bucket := location.Host
+	key := strings.TrimPrefix(location.Path, "/")
+	if key != "" && !strings.HasSuffix(key, "/") {
+		key += "/"
+	}
+	key += HealthCheckObjectName
+
+	_, err = s3Svc.PutObject(ctx, &s3.PutObjectInput{
+		Bucket: &bucket,
+		Key:    &key,
+		Body:   bytes.NewReader([]byte{}),
+	})
+	if err != nil {
+		return err
+	}
+	// removing the marker is best effort, write access is what athena needs
+	_, _ = s3Svc.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: &bucket,
+		Key:    &key,
+	})
+	return nil
+}
+
+func newHealthResult(status backend.HealthStatus, steps []HealthCheckStep) *backend.CheckHealthResult {
+	messages := make([]string, 0, len(steps))
+	for _, step := range steps {
+		mark := "OK"
+		if !step.OK {
+			mark = "FAILED"
+		}
+		messages = append(messages, fmt.Sprintf("%s: %s - %s", step.Name, mark, step.Message))
+	}
+	details, _ := json.Marshal(map[string]interface{}{"steps": steps})
+	return &backend.CheckHealthResult{
+		Status:      status,
+		Message:     strings.Join(messages, "\n"),
+		JSONDetails: details,
+	}
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// macroPattern matches $__name and $__name(args) macros
+var macroPattern = regexp.MustCompile(`\$__(\w+)(?:\(([^)]*)\))?`)
+
+// macroPlaceholderPattern matches the placeholders macros are kept in while variables are interpolated
+var macroPlaceholderPattern = regexp.MustCompile("\x00(\\d+)\x00")
+
+// trailingSemicolonPattern matches statement terminators that cannot be wrapped into a subquery
+var trailingSemicolonPattern = regexp.MustCompile(`[;\s]+$`)
+
+// leadingCommentPattern matches whitespace, comments and parentheses before the first keyword of a statement
+var leadingCommentPattern = regexp.MustCompile(`^(\s+|--[^\n]*|/\*(?s:.*?)\*/|\()*`)
+
+// selectStatementPattern matches the statements that can be wrapped into a subquery
+var selectStatementPattern = regexp.MustCompile(`(?i)^(SELECT|WITH)\b`)
+
+// orderLimitPattern matches the clauses that change the rows of a statement when it is wrapped into a subquery
+var orderLimitPattern = regexp.MustCompile(`(?i)\b(ORDER\s+BY|LIMIT|OFFSET|FETCH)\b`)
+
+// prepareQueryString expands the macros and interpolates the template variables of sql.
+// Macros are expanded on the sql as written, variable values cannot contain macros. Variables in
+// macro arguments are interpolated first and must be column names.
+func prepareQueryString(sql string, opt *AthenaDatasourceQueryOption) (string, error) {
+	expansions := make([]string, 0)
+	hasAdhocFilters := false
+	contexts := sqlContexts(sql)
+	var expanded strings.Builder
+	last := 0
+	for _, loc := range macroPattern.FindAllStringSubmatchIndex(sql, -1) {
+		if contexts[loc[0]] != sqlContextCode {
+			// macros in strings and comments are kept as written
+			continue
+		}
+		name := sql[loc[2]:loc[3]]
+		var expansion string
+		var err error
+		switch name {
+		case MacroAdhocFilters:
+			hasAdhocFilters = true
+			if expansion, err = adhocFilterCondition(opt.AdhocFilters); expansion == "" {
+				expansion = "1=1"
+			}
+		case MacroTimeFilter, MacroPartitionFilter:
+			args := ""
+			if loc[4] >= 0 {
+				args = sql[loc[4]:loc[5]]
+			}
+			if args, err = interpolateMacroArgs(args, opt.Variables); err != nil {
+				break
+			}
+			if name == MacroTimeFilter {
+				expansion, err = timeFilterMacro(macroArgs(args), opt)
+			} else {
+				expansion, err = partitionFilterMacro(macroArgs(args), opt)
+			}
+		default:
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		expansions = append(expansions, expansion)
+		expanded.WriteString(sql[last:loc[0]])
+		fmt.Fprintf(&expanded, "\x00%d\x00", len(expansions)-1)
+		last = loc[1]
+	}
+	expanded.WriteString(sql[last:])
+	sql = expanded.String()
+
+	sql, err := interpolateVariables(sql, opt.Variables)
+	if err != nil {
+		return "", err
+	}
+	sql = macroPlaceholderPattern.ReplaceAllStringFunc(sql, func(match string) string {
+		i, _ := strconv.Atoi(macroPlaceholderPattern.FindStringSubmatch(match)[1])
+		return expansions[i]
+	})
+
+	if hasAdhocFilters {
+		return sql, nil
+	}
+	return wrapAdhocFilters(sql, opt.AdhocFilters)
+}
+
+// macroArgPattern matches the variable values macro arguments take, a column with an optional partition format
+var macroArgPattern = regexp.MustCompile(`^[\w.]+(:[\w./ -]+)?$`)
+
+// interpolateMacroArgs substitutes the template variables of macro arguments, each value becomes an argument.
+// Arguments are columns rather than values, so variable values are checked instead of escaped.
+func interpolateMacroArgs(args string, variables map[string][]string) (string, error) {
+	var argErr error
+	args = variablePattern.ReplaceAllStringFunc(args, func(match string) string {
+		name, _ := variableReference(variablePattern.FindStringSubmatch(match))
+		values, ok := variables[name]
+		if !ok {
+			if argErr == nil {
+				argErr = fmt.Errorf("Error. Unknown variable %s in macro arguments", name)
+			}
+			return match
+		}
+		for _, value := range values {
+			if !macroArgPattern.MatchString(value) && argErr == nil {
+				argErr = fmt.Errorf("Error. Variable %s: %q is not a column name", name, value)
+			}
+		}
+		return strings.Join(values, ", ")
+	})
+	if argErr != nil {
+		return "", argErr
+	}
+	return args, nil
+}
+
+// macroArgs splits the comma separated arguments of a macro call
+func macroArgs(args string) []string {
+	if strings.TrimSpace(args) == "" {
+		return nil
+	}
+	parts := strings.Split(args, ",")
+	for i := range parts {
+		parts[i] = strings.TrimSpace(parts[i])
+	}
+	return parts
+}
+
+// timeFilterMacro renders $__timeFilter(column) as a range of the dashboard time range
+func timeFilterMacro(args []string, opt *AthenaDatasourceQueryOption) (string, error) {
+	if len(args) != 1 || args[0] == "" {
+		return "", fmt.Errorf("Error. $__timeFilter expects a column")
+	}
+	return fmt.Sprintf("%s BETWEEN TIMESTAMP '%s' AND TIMESTAMP '%s'", args[0],
+		opt.From.UTC().Format(ParameterTimestampLayout), opt.To.UTC().Format(ParameterTimestampLayout)), nil
+}
+
+// wrapAdhocFilters filters queries without the $__adhocFilters macro as a subquery,
+// other statements like SHOW, DESCRIBE or EXECUTE cannot be filtered and are left as they are
+func wrapAdhocFilters(sql string, filters []AdhocFilter) (string, error) {
+	if !isSelectStatement(sql) {
+		return sql, nil
+	}
+	condition, err := adhocFilterCondition(filters)
+	if err != nil || condition == "" {
+		return sql, err
+	}
+	if hasTopLevelOrderOrLimit(sql) {
+		// the filtered rows would neither keep the order nor fill the limit
+		return "", fmt.Errorf("Error. Use $__adhocFilters in the WHERE clause of queries with ORDER BY or LIMIT")
+	}
+	// the query goes on its own lines so a trailing line comment cannot swallow the closing parenthesis
+	return fmt.Sprintf("SELECT * FROM (\n%s\n) AS adhoc_filtered WHERE %s", trailingSemicolonPattern.ReplaceAllString(sql, ""), condition), nil
+}
+
+func isSelectStatement(sql string) bool {
+	return selectStatementPattern.MatchString(leadingCommentPattern.ReplaceAllString(sql, ""))
+}
+
+// hasTopLevelOrderOrLimit reports ORDER BY, LIMIT, OFFSET or FETCH outside of subqueries, strings and comments of sql
+func hasTopLevelOrderOrLimit(sql string) bool {
+	contexts := sqlContexts(sql)
+	code := []byte(sql)
+	depth := 0
+	for i := range code {
+		if contexts[i] != sqlContextCode {
+			code[i] = ' '
+			continue
+		}
+		switch code[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		}
+		if depth > 0 || code[i] == ')' {
+			code[i] = ' '
+		}
+	}
+	return orderLimitPattern.Match(code)
+}
+
+// adhocFilterCondition joins the filters with AND, values are compared as quoted sql strings
+func adhocFilterCondition(filters []AdhocFilter) (string, error) {
+	conditions := make([]string, 0, len(filters))
+	for _, filter := range filters {
+		if strings.TrimSpace(filter.Key) == "" {
+			continue
+		}
+		column, err := quoteIdentifier(filter.Key)
+		if err != nil {
+			return "", err
+		}
+		value := "'" + strings.ReplaceAll(filter.Value, "'", "''") + "'"
+		switch filter.Operator {
+		case "=", "!=":
+			op := filter.Operator
+			if op == "!=" {
+				op = "<>"
+			}
+			// comparing as varchar works for columns of any type
+			conditions = append(conditions, fmt.Sprintf("CAST(%s AS varchar) %s %s", column, op, value))
+		case "<", ">":
+			if numberPattern.MatchString(filter.Value) {
+				value = filter.Value
+			}
+			conditions = append(conditions, fmt.Sprintf("%s %s %s", column, filter.Operator, value))
+		case "=~":
+			conditions = append(conditions, fmt.Sprintf("regexp_like(CAST(%s AS varchar), %s)", column, value))
+		case "!~":
+			conditions = append(conditions, fmt.Sprintf("NOT regexp_like(CAST(%s AS varchar), %s)", column, value))
+		default:
+			return "", fmt.Errorf("Error. Unsupported ad-hoc filter operator %s", filter.Operator)
+		}
+	}
+	return strings.Join(conditions, " AND "), nil
+}
+
+// quoteIdentifier quotes each part of a possibly qualified column name
+func quoteIdentifier(name string) (string, error) {
+	parts := strings.Split(name, ".")
+	for i, part := range parts {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			return "", fmt.Errorf("Error. Invalid column name %q", name)
+		}
+		parts[i] = `"` + strings.ReplaceAll(part, `"`, `""`) + `"`
+	}
+	return strings.Join(parts, "."), nil
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWrapAdhocFilters(t *testing.T) {
+	filters := []AdhocFilter{{Key: "host", Operator: "=", Value: "web-1"}}
+	tests := []struct {
+		name string
+		sql  string
+		want string
+	}{
+		{"select", "SELECT * FROM logs;", "SELECT * FROM (\nSELECT * FROM logs\n) AS adhoc_filtered WHERE CAST(\"host\" AS varchar) = 'web-1'"},
+		{"with", "WITH t AS (SELECT 1) SELECT * FROM t", "SELECT * FROM (\nWITH t AS (SELECT 1) SELECT * FROM t\n) AS adhoc_filtered WHERE CAST(\"host\" AS varchar) = 'web-1'"},
+		{"leading comment", "-- errors\n/* by host */ (select * from logs)", "SELECT * FROM (\n-- errors\n/* by host */ (select * from logs)\n) AS adhoc_filtered WHERE CAST(\"host\" AS varchar) = 'web-1'"},
+		{"show", "SHOW TABLES", "SHOW TABLES"},
+		{"describe", "DESCRIBE logs", "DESCRIBE logs"},
+		{"ddl", "CREATE TABLE t AS SELECT * FROM logs", "CREATE TABLE t AS SELECT * FROM logs"},
+		{"execute", "EXECUTE stmt USING 1", "EXECUTE stmt USING 1"},
+		{"selection name", "SELECTED", "SELECTED"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := wrapAdhocFilters(tt.sql, filters)
+			if err != nil {
+				t.Fatalf("wrapAdhocFilters(%q) error = %v", tt.sql, err)
+			}
+			if got != tt.want {
+				t.Errorf("wrapAdhocFilters(%q) = %q, want %q", tt.sql, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWrapAdhocFiltersOrderLimit(t *testing.T) {
+	filters := []AdhocFilter{{Key: "host", Operator: "=", Value: "web-1"}}
+	tests := []struct {
+		name    string
+		sql     string
+		wrapped bool
+	}{
+		{"order by", "SELECT * FROM logs ORDER BY time DESC", false},
+		{"limit", "SELECT * FROM logs\nlimit 10;", false},
+		{"offset", "SELECT * FROM logs OFFSET 10", false},
+		{"with order by", "WITH t AS (SELECT 1) SELECT * FROM t ORDER BY 1", false},
+		{"subquery order by", "SELECT * FROM (SELECT * FROM logs ORDER BY time LIMIT 10) AS t", true},
+		{"window order by", "SELECT row_number() OVER (ORDER BY time) FROM logs", true},
+		{"string", "SELECT * FROM logs WHERE message = 'order by limit'", true},
+		{"comment", "SELECT * FROM logs -- limit 10", true},
+		{"identifier", `SELECT "limit" FROM logs`, true},
+		{"column name", "SELECT limited, ordered FROM logs", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := wrapAdhocFilters(tt.sql, filters)
+			if !tt.wrapped {
+				if err == nil || !strings.Contains(err.Error(), "Use $__adhocFilters") {
+					t.Fatalf("wrapAdhocFilters(%q) = %q, %v, want an error", tt.sql, got, err)
+				}
+				return
+			}
+			if err != nil || !strings.HasPrefix(got, "SELECT * FROM (\n") {
+				t.Errorf("wrapAdhocFilters(%q) = %q, %v, want it wrapped", tt.sql, got, err)
+			}
+		})
+	}
+
+	if got, err := wrapAdhocFilters("SELECT * FROM logs LIMIT 10", nil); err != nil || got != "SELECT * FROM logs LIMIT 10" {
+		t.Errorf("wrapAdhocFilters without filters = %q, %v", got, err)
+	}
+}
+
+func TestAdhocFilterCondition(t *testing.T) {
+	tests := []struct {
+		name    string
+		filters []AdhocFilter
+		want    string
+		err     string
+	}{
+		{"none", nil, "", ""},
+		{"equal", []AdhocFilter{{Key: "host", Operator: "=", Value: "it's"}}, `CAST("host" AS varchar) = 'it''s'`, ""},
+		{"not equal", []AdhocFilter{{Key: "host", Operator: "!=", Value: "a"}}, `CAST("host" AS varchar) <> 'a'`, ""},
+		{"less numeric", []AdhocFilter{{Key: "cpu", Operator: "<", Value: "0.5"}}, `"cpu" < 0.5`, ""},
+		{"greater string", []AdhocFilter{{Key: "day", Operator: ">", Value: "2020-01-01"}}, `"day" > '2020-01-01'`, ""},
+		{"regex", []AdhocFilter{{Key: "host", Operator: "=~", Value: "web.*"}}, `regexp_like(CAST("host" AS varchar), 'web.*')`, ""},
+		{"not regex", []AdhocFilter{{Key: "host", Operator: "!~", Value: "db"}}, `NOT regexp_like(CAST("host" AS varchar), 'db')`, ""},
+		{"qualified key", []AdhocFilter{{Key: `t.ho"st`, Operator: "=", Value: "a"}}, `CAST("t"."ho""st" AS varchar) = 'a'`, ""},
+		{"empty key skipped", []AdhocFilter{{Key: " ", Operator: "=", Value: "a"}}, "", ""},
+		{"joined", []AdhocFilter{{Key: "a", Operator: "=", Value: "1"}, {Key: "b", Operator: ">", Value: "2"}}, `CAST("a" AS varchar) = '1' AND "b" > 2`, ""},
+		{"unsupported operator", []AdhocFilter{{Key: "a", Operator: "LIKE", Value: "1"}}, "", "Unsupported ad-hoc filter operator"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := adhocFilterCondition(tt.filters)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("adhocFilterCondition error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("adhocFilterCondition error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("adhocFilterCondition = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrepareQueryStringAdhocFilters(t *testing.T) {
+	opt := &AthenaDatasourceQueryOption{AdhocFilters: []AdhocFilter{{Key: "host", Operator: "=", Value: "web-1"}}}
+	tests := []struct {
+		name string
+		sql  string
+		want string
+	}{
+		{"macro", "SELECT * FROM logs WHERE $__adhocFilters", `SELECT * FROM logs WHERE CAST("host" AS varchar) = 'web-1'`},
+		{"wrapped", "SELECT * FROM logs", "SELECT * FROM (\nSELECT * FROM logs\n) AS adhoc_filtered WHERE CAST(\"host\" AS varchar) = 'web-1'"},
+		{"not wrapped", "SHOW TABLES", "SHOW TABLES"},
+		{"macro in comment", "SELECT * FROM logs -- WHERE $__adhocFilters", "SELECT * FROM (\nSELECT * FROM logs -- WHERE $__adhocFilters\n) AS adhoc_filtered WHERE CAST(\"host\" AS varchar) = 'web-1'"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := prepareQueryString(tt.sql, opt)
+			if err != nil {
+				t.Fatalf("prepareQueryString(%q) error = %v", tt.sql, err)
+			}
+			if got != tt.want {
+				t.Errorf("prepareQueryString(%q) = %q, want %q", tt.sql, got, tt.want)
+			}
+		})
+	}
+
+	got, err := prepareQueryString("SELECT * FROM logs WHERE $__adhocFilters", &AthenaDatasourceQueryOption{})
+	if err != nil || got != "SELECT * FROM logs WHERE 1=1" {
+		t.Errorf("prepareQueryString without filters = %q, %v", got, err)
+	}
+}
+
+func TestPrepareQueryStringMacros(t *testing.T) {
+	opt := &AthenaDatasourceQueryOption{
+		From: time.Date(2020, 1, 1, 22, 0, 0, 0, time.UTC),
+		To:   time.Date(2020, 1, 2, 1, 30, 0, 0, time.UTC),
+		Variables: map[string][]string{
+			"col":  {"ts"},
+			"cols": {"year", "month"},
+			"dt":   {"dt:yyyy-MM-dd"},
+			"host": {"$__timeFilter(x)"},
+			"bad":  {"x) OR 1=1 --"},
+		},
+	}
+	tests := []struct {
+		name string
+		sql  string
+		want string
+		err  string
+	}{
+		{"time filter", "WHERE $__timeFilter(ts)", "WHERE ts BETWEEN TIMESTAMP '2020-01-01 22:00:00.000' AND TIMESTAMP '2020-01-02 01:30:00.000'", ""},
+		{"time filter variable", "WHERE $__timeFilter($col)", "WHERE ts BETWEEN TIMESTAMP '2020-01-01 22:00:00.000' AND TIMESTAMP '2020-01-02 01:30:00.000'", ""},
+		{"time filter without column", "WHERE $__timeFilter()", "", "expects a column"},
+		{"partition filter variables", "WHERE $__partitionFilter($cols)", `WHERE ("year" BETWEEN '2020' AND '2020' AND "month" IN ('01') AND concat("year", "month") BETWEEN '202001' AND '202001')`, ""},
+		{"partition filter format variable", "WHERE $__partitionFilter(${dt})", `WHERE "dt" BETWEEN '2020-01-01' AND '2020-01-02'`, ""},
+		{"argument variable checked", "WHERE $__timeFilter($bad)", "", "is not a column name"},
+		{"argument variable unknown", "WHERE $__timeFilter($other)", "", "Unknown variable other"},
+		{"variable values are not macros", "WHERE host = $host", "WHERE host = '$__timeFilter(x)'", ""},
+		{"unknown macro kept", "SELECT $__unknown", "SELECT $__unknown", ""},
+		{"macro in string kept", "SELECT '$__timeFilter(x)'", "SELECT '$__timeFilter(x)'", ""},
+		{"macro in line comment kept", "SELECT 1 -- $__timeFilter()\nWHERE $__timeFilter(ts)", "SELECT 1 -- $__timeFilter()\nWHERE ts BETWEEN TIMESTAMP '2020-01-01 22:00:00.000' AND TIMESTAMP '2020-01-02 01:30:00.000'", ""},
+		{"macro in block comment kept", "SELECT /* $__partitionFilter($bad) */ 1", "SELECT /* $__partitionFilter($bad) */ 1", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := prepareQueryString(tt.sql, opt)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("prepareQueryString(%q) error = %v, want %q", tt.sql, err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("prepareQueryString(%q) error = %v", tt.sql, err)
+			}
+			if got != tt.want {
+				t.Errorf("prepareQueryString(%q) = %q, want %q", tt.sql, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// numberPattern matches the decimal literals athena accepts, ParseFloat would also take NaN, Inf or hex
+var numberPattern = regexp.MustCompile(`^[+-]?(\d+\.?\d*|\.\d+)([eE][+-]?\d+)?$`)
+
+// executionParameters resolves the query parameters to athena literals for the ? placeholders, in order
+func executionParameters(opt *AthenaDatasourceQueryOption) ([]string, error) {
+	if len(opt.Parameters) == 0 {
+		return nil, nil
+	}
+	literals := make([]string, 0, len(opt.Parameters))
+	for i, param := range opt.Parameters {
+		literal, err := parameterLiteral(param, opt)
+		if err != nil {
+			return nil, fmt.Errorf("Error. Parameter %d: %v", i+1, err)
+		}
+		literals = append(literals, literal)
+	}
+	return literals, nil
+}
+
+// parameterLiteral formats a literal, variable or time range parameter value as an athena literal of its type
+func parameterLiteral(param QueryParameter, opt *AthenaDatasourceQueryOption) (string, error) {
+	value := strings.TrimSpace(param.Value)
+	var timeValue *time.Time
+	switch value {
+	case ParameterTimeFrom:
+		timeValue = &opt.From
+	case ParameterTimeTo:
+		timeValue = &opt.To
+	default:
+		// a value that is a single variable reference takes the value of the variable
+		if groups := variablePattern.FindStringSubmatch(value); groups != nil && groups[0] == value {
+			name, _ := variableReference(groups)
+			values, ok := opt.Variables[name]
+			if !ok {
+				return "", fmt.Errorf("unknown variable %s", name)
+			}
+			if len(values) != 1 {
+				return "", fmt.Errorf("variable %s has %d values, parameters take a single value", name, len(values))
+			}
+			value = values[0]
+		}
+	}
+	return formatLiteral(value, timeValue, param.Type)
+}
+
+// formatLiteral formats a value, or the time range bound timeValue if set, as an athena literal of paramType
+func formatLiteral(value string, timeValue *time.Time, paramType ParameterType) (string, error) {
+	switch paramType {
+	case ParameterTypeString:
+		if timeValue != nil {
+			value = timeValue.UTC().Format(time.RFC3339Nano)
+		}
+		return "'" + strings.ReplaceAll(value, "'", "''") + "'", nil
+	case ParameterTypeNumber:
+		if timeValue != nil {
+			return strconv.FormatInt(timeValue.UnixNano()/int64(time.Millisecond), 10), nil
+		}
+		if !numberPattern.MatchString(value) {
+			return "", fmt.Errorf("invalid number %q", value)
+		}
+		return value, nil
+	case ParameterTypeBoolean:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return "", fmt.Errorf("invalid boolean %q", value)
+		}
+		return strconv.FormatBool(b), nil
+	case ParameterTypeTimestamp, ParameterTypeDate:
+		t, err := parameterTime(value, timeValue)
+		if err != nil {
+			return "", err
+		}
+		if paramType == ParameterTypeDate {
+			return "DATE '" + t.Format(DateLayout) + "'", nil
+		}
+		return "TIMESTAMP '" + t.Format(ParameterTimestampLayout) + "'", nil
+	default:
+		return "", fmt.Errorf("unknown type %s", paramType)
+	}
+}
+
+// parameterTime reads timestamps as athena layouts, RFC3339 or epoch milliseconds as grafana sends them
+func parameterTime(value string, timeValue *time.Time) (time.Time, error) {
+	if timeValue != nil {
+		return timeValue.UTC(), nil
+	}
+	if ms, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(0, ms*int64(time.Millisecond)).UTC(), nil
+	}
+	t, err := parseTimestamp(value)
+	if err != nil {
+		return t, fmt.Errorf("invalid timestamp %q", value)
+	}
+	return t.UTC(), nil
+}
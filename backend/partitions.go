@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+type partitionUnit int
+
+const (
+	partitionUnitNone partitionUnit = iota
+	partitionUnitYear
+	partitionUnitMonth
+	partitionUnitDay
+	partitionUnitHour
+	partitionUnitMinute
+)
+
+// partitionFormatTokens are the date format tokens of partition values, as athena partition projection writes them
+var partitionFormatTokens = []struct {
+	token  string
+	layout string
+	unit   partitionUnit
+}{
+	{"yyyy", "2006", partitionUnitYear},
+	{"MM", "01", partitionUnitMonth},
+	{"dd", "02", partitionUnitDay},
+	{"HH", "15", partitionUnitHour},
+	{"mm", "04", partitionUnitMinute},
+}
+
+// namedPartitionFormats are the formats of partition columns given without a format by their name
+var namedPartitionFormats = map[string]string{
+	"year":   "yyyy",
+	"month":  "MM",
+	"day":    "dd",
+	"hour":   "HH",
+	"minute": "mm",
+}
+
+// defaultPartitionFormats are the formats of other partition columns given without a format by their position
+var defaultPartitionFormats = []string{"yyyy", "MM", "dd", "HH", "mm"}
+
+// partitionColumn is a string partition column and the date format of its values
+type partitionColumn struct {
+	name   string
+	format string
+	unit   partitionUnit
+}
+
+// partitionFilterMacro renders $__partitionFilter(column[:format], ...) as predicates on string partition columns
+// that athena can prune partitions by. Columns go from the coarsest to the finest, e.g. year, month, day, hour
+// or a single dt:yyyy-MM-dd column. Columns without a format are formatted by their name or position.
+func partitionFilterMacro(args []string, opt *AthenaDatasourceQueryOption) (string, error) {
+	columns, err := parsePartitionColumns(args)
+	if err != nil {
+		return "", err
+	}
+	from, to := opt.From.UTC(), opt.To.UTC()
+
+	// the first column is contiguous over the time range
+	conditions := []string{fmt.Sprintf("%s BETWEEN '%s' AND '%s'", columns[0].name, columns[0].value(from), columns[0].value(to))}
+	if len(columns) == 1 {
+		return conditions[0], nil
+	}
+	// finer columns wrap around, listing their values prunes short time ranges
+	for _, column := range columns[1:] {
+		if values := column.values(from, to); values != nil {
+			conditions = append(conditions, fmt.Sprintf("%s IN ('%s')", column.name, strings.Join(values, "', '")))
+		}
+	}
+	// the concatenated values bound the time range exactly
+	names := make([]string, len(columns))
+	fromValue, toValue := "", ""
+	for i, column := range columns {
+		names[i] = column.name
+		fromValue += column.value(from)
+		toValue += column.value(to)
+	}
+	conditions = append(conditions, fmt.Sprintf("concat(%s) BETWEEN '%s' AND '%s'", strings.Join(names, ", "), fromValue, toValue))
+	return "(" + strings.Join(conditions, " AND ") + ")", nil
+}
+
+func parsePartitionColumns(args []string) ([]partitionColumn, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("Error. $__partitionFilter expects partition columns")
+	}
+	columns := make([]partitionColumn, 0, len(args))
+	for i, arg := range args {
+		name, format := arg, ""
+		if j := strings.Index(arg, ":"); j >= 0 {
+			name, format = strings.TrimSpace(arg[:j]), strings.Trim(strings.TrimSpace(arg[j+1:]), `'"`)
+		}
+		if format == "" {
+			format = namedPartitionFormats[strings.ToLower(name)]
+		}
+		if format == "" {
+			if i >= len(defaultPartitionFormats) {
+				return nil, fmt.Errorf("Error. Partition column %s needs a format", name)
+			}
+			format = defaultPartitionFormats[i]
+		}
+		quoted, err := quoteIdentifier(name)
+		if err != nil {
+			return nil, err
+		}
+		column := partitionColumn{name: quoted, format: format}
+		for _, token := range partitionFormatTokens {
+			if strings.Contains(format, token.token) && token.unit > column.unit {
+				column.unit = token.unit
+			}
+		}
+		if column.unit == partitionUnitNone {
+			return nil, fmt.Errorf("Error. Invalid format %s of partition column %s", format, name)
+		}
+		// values are compared as strings, quotes would end the literal
+		if strings.Contains(format, "'") {
+			return nil, fmt.Errorf("Error. Invalid format %s of partition column %s", format, name)
+		}
+		columns = append(columns, column)
+	}
+	return columns, nil
+}
+
+// value formats t as a partition value, characters other than the tokens are kept
+func (column partitionColumn) value(t time.Time) string {
+	var value strings.Builder
+	for i := 0; i < len(column.format); {
+		matched := false
+		for _, token := range partitionFormatTokens {
+			if strings.HasPrefix(column.format[i:], token.token) {
+				value.WriteString(t.Format(token.layout))
+				i += len(token.token)
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			value.WriteByte(column.format[i])
+			i++
+		}
+	}
+	return value.String()
+}
+
+// values lists the distinct values of the column over the time range, nil if there are too many to be worth it
+func (column partitionColumn) values(from time.Time, to time.Time) []string {
+	values := make([]string, 0)
+	seen := make(map[string]bool)
+	steps := 0
+	for t := column.truncate(from); !t.After(to); t = column.next(t) {
+		if steps++; steps > PartitionFilterMaxValues {
+			return nil
+		}
+		if value := column.value(t); !seen[value] {
+			seen[value] = true
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+func (column partitionColumn) truncate(t time.Time) time.Time {
+	switch column.unit {
+	case partitionUnitYear:
+		return time.Date(t.Year(), 1, 1, 0, 0, 0, 0, t.Location())
+	case partitionUnitMonth:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+	case partitionUnitDay:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	case partitionUnitHour:
+		return t.Truncate(time.Hour)
+	default:
+		return t.Truncate(time.Minute)
+	}
+}
+
+func (column partitionColumn) next(t time.Time) time.Time {
+	switch column.unit {
+	case partitionUnitYear:
+		return t.AddDate(1, 0, 0)
+	case partitionUnitMonth:
+		return t.AddDate(0, 1, 0)
+	case partitionUnitDay:
+		return t.AddDate(0, 0, 1)
+	case partitionUnitHour:
+		return t.Add(time.Hour)
+	default:
+		return t.Add(time.Minute)
+	}
+}
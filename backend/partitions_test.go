@@ -0,0 +1,63 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPartitionFilterMacro(t *testing.T) {
+	opt := &AthenaDatasourceQueryOption{
+		From: time.Date(2020, 1, 1, 22, 0, 0, 0, time.UTC),
+		To:   time.Date(2020, 1, 2, 1, 30, 0, 0, time.UTC),
+	}
+	tests := []struct {
+		name string
+		args string
+		want string
+		err  string
+	}{
+		{"single column", "dt:yyyy-MM-dd", `"dt" BETWEEN '2020-01-01' AND '2020-01-02'`, ""},
+		{"quoted format", "dt:'yyyy/MM/dd-HH'", `"dt" BETWEEN '2020/01/01-22' AND '2020/01/02-01'`, ""},
+		{"named columns", "year, month, day, hour",
+			`("year" BETWEEN '2020' AND '2020' AND "month" IN ('01') AND "day" IN ('01', '02') AND "hour" IN ('22', '23', '00', '01')` +
+				` AND concat("year", "month", "day", "hour") BETWEEN '2020010122' AND '2020010201')`, ""},
+		{"positional formats", "y, m",
+			`("y" BETWEEN '2020' AND '2020' AND "m" IN ('01') AND concat("y", "m") BETWEEN '202001' AND '202001')`, ""},
+		{"named format wins over position", "dt:yyyy-MM-dd, hour",
+			`("dt" BETWEEN '2020-01-01' AND '2020-01-02' AND "hour" IN ('22', '23', '00', '01')` +
+				` AND concat("dt", "hour") BETWEEN '2020-01-0122' AND '2020-01-0201')`, ""},
+		{"no columns", "", "", "expects partition columns"},
+		{"no format", "a, b, c, d, e, f", "", "needs a format"},
+		{"invalid format", "dt:abc", "", "Invalid format"},
+		{"quote in format", "dt:yyyy'MM", "", "Invalid format"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := partitionFilterMacro(macroArgs(tt.args), opt)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("partitionFilterMacro(%q) error = %v, want %q", tt.args, err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("partitionFilterMacro(%q) error = %v", tt.args, err)
+			}
+			if got != tt.want {
+				t.Errorf("partitionFilterMacro(%q) = %q, want %q", tt.args, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPartitionColumnValues(t *testing.T) {
+	column := partitionColumn{name: `"hour"`, format: "HH", unit: partitionUnitHour}
+	from := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	if values := column.values(from, from.Add(3*time.Hour)); strings.Join(values, ",") != "00,01,02,03" {
+		t.Errorf("values over 3 hours = %v", values)
+	}
+	if values := column.values(from, from.Add(PartitionFilterMaxValues*time.Hour)); values != nil {
+		t.Errorf("values over %d hours = %v, want nil", PartitionFilterMaxValues, values)
+	}
+}
@@ -1,39 +1,32 @@
 package main
 
 import (
-	"github.com/grafana/grafana-plugin-model/go/datasource"
-	hclog "github.com/hashicorp/go-hclog"
-	plugin "github.com/hashicorp/go-plugin"
+	"os"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/datasource"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/resource/httpadapter"
 )
 
-var pluginLogger = hclog.New(&hclog.LoggerOptions{
-	Name:  PluginName,
-	Level: hclog.LevelFromString("DEBUG"),
-})
+var pluginLogger = log.DefaultLogger
 
 func main() {
 	pluginLogger.Debug("Running AWS Athena backend datasource")
 
-	plugin.Serve(&plugin.ServeConfig{
-
-		HandshakeConfig: plugin.HandshakeConfig{
-			ProtocolVersion:  1,
-			MagicCookieKey:   "grafana_plugin_type",
-			MagicCookieValue: "datasource",
+	ds := &AwsAthenaDatasource{
+		logger: pluginLogger,
+		athena: &AwsAthenaQueryHandler{
+			logger:        pluginLogger,
+			cache:         make(map[string]*QueryCacheInfo),
+			resourceCache: make(map[string]*ResourceCacheInfo),
 		},
-		Plugins: map[string]plugin.Plugin{
-			PluginName: &datasource.DatasourcePluginImpl{
-				Plugin: &AwsAthenaDatasource{
-					logger: pluginLogger,
-					athena: &AwsAthenaQueryHandler{
-						logger: pluginLogger,
-						cache:  make(map[string]*QueryCacheInfo),
-					},
-				},
-			},
-		},
-
-		// A non-nil value here enables gRPC serving for this plugin...
-		GRPCServer: plugin.DefaultGRPCServer,
-	})
+	}
+	if err := datasource.Serve(datasource.ServeOpts{
+		QueryDataHandler:    ds,
+		CheckHealthHandler:  ds,
+		CallResourceHandler: httpadapter.New(ds.newResourceMux()),
+	}); err != nil {
+		pluginLogger.Error(err.Error())
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,336 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/athena"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/resource/httpadapter"
+)
+
+// TableColumn describes a table column for autocomplete, partition keys are included
+type TableColumn struct {
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	Comment   string `json:"comment,omitempty"`
+	Partition bool   `json:"partition"`
+}
+
+// ResourceCacheInfo holds a listed catalog resource until it expires
+type ResourceCacheInfo struct {
+	Value          interface{}
+	ExpirationTime time.Time
+}
+
+// IsExpired ..
+func (info *ResourceCacheInfo) IsExpired() bool {
+	return time.Now().After(info.ExpirationTime)
+}
+
+// newResourceMux routes the resource calls of the query editor
+func (ds *AwsAthenaDatasource) newResourceMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/catalogs", ds.handleResource(func(ctx context.Context, opt *AthenaDatasourceQueryOption, params url.Values) (interface{}, error) {
+		return ds.athena.ListCatalogs(ctx, opt)
+	}))
+	mux.HandleFunc("/databases", ds.handleResource(func(ctx context.Context, opt *AthenaDatasourceQueryOption, params url.Values) (interface{}, error) {
+		return ds.athena.ListDatabases(ctx, opt, catalogParam(opt, params))
+	}))
+	mux.HandleFunc("/tables", ds.handleResource(func(ctx context.Context, opt *AthenaDatasourceQueryOption, params url.Values) (interface{}, error) {
+		database, err := databaseParam(opt, params)
+		if err != nil {
+			return nil, err
+		}
+		return ds.athena.ListTables(ctx, opt, catalogParam(opt, params), database)
+	}))
+	mux.HandleFunc("/columns", ds.handleResource(func(ctx context.Context, opt *AthenaDatasourceQueryOption, params url.Values) (interface{}, error) {
+		database, err := databaseParam(opt, params)
+		if err != nil {
+			return nil, err
+		}
+		table, err := requiredParam(params, "table")
+		if err != nil {
+			return nil, err
+		}
+		return ds.athena.ListColumns(ctx, opt, catalogParam(opt, params), database, table)
+	}))
+	mux.HandleFunc("/prepared-statements", ds.handleResource(func(ctx context.Context, opt *AthenaDatasourceQueryOption, params url.Values) (interface{}, error) {
+		if workGroup := strings.TrimSpace(params.Get("workGroup")); workGroup != "" {
+			opt.WorkGroup = workGroup
+		}
+		if opt.WorkGroup == "" {
+			return nil, fmt.Errorf("%w workGroup", errMissingParam)
+		}
+		return ds.athena.ListPreparedStatements(ctx, opt)
+	}))
+	return mux
+}
+
+// catalogParam returns the catalog parameter, the datasource default or the default athena catalog
+func catalogParam(opt *AthenaDatasourceQueryOption, params url.Values) string {
+	if catalog := strings.TrimSpace(params.Get("catalog")); catalog != "" {
+		return catalog
+	}
+	if catalog := executionCatalog(opt); catalog != "" {
+		return catalog
+	}
+	return DefaultCatalog
+}
+
+// databaseParam returns the database parameter or the datasource default
+func databaseParam(opt *AthenaDatasourceQueryOption, params url.Values) (string, error) {
+	if database := strings.TrimSpace(params.Get("database")); database != "" {
+		return database, nil
+	}
+	if database := executionDatabase(opt); database != "" {
+		return database, nil
+	}
+	return "", fmt.Errorf("%w database", errMissingParam)
+}
+
+var errMissingParam = errors.New("Missing parameter")
+
+func requiredParam(params url.Values, name string) (string, error) {
+	value := strings.TrimSpace(params.Get(name))
+	if value == "" {
+		return "", fmt.Errorf("%w %s", errMissingParam, name)
+	}
+	return value, nil
+}
+
+type resourceFunc func(ctx context.Context, opt *AthenaDatasourceQueryOption, params url.Values) (interface{}, error)
+
+// handleResource parses the datasource settings and writes the listed resource as json
+func (ds *AwsAthenaDatasource) handleResource(fn resourceFunc) http.HandlerFunc {
+	return func(rw http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			writeResourceError(rw, http.StatusMethodNotAllowed, fmt.Errorf("Method %s not allowed", req.Method))
+			return
+		}
+		ctx := req.Context()
+		opt, err := ds.parseSettings(httpadapter.PluginConfigFromContext(ctx))
+		if err != nil {
+			writeResourceError(rw, http.StatusBadRequest, err)
+			return
+		}
+
+		params := req.URL.Query()
+		if region := strings.TrimSpace(params.Get("region")); region != "" {
+			opt.Region = region
+		}
+		ds.logger.Debug("handleResource", "path", req.URL.Path, "params", req.URL.RawQuery)
+
+		value, err := fn(ctx, opt, params)
+		if errors.Is(err, errMissingParam) {
+			writeResourceError(rw, http.StatusBadRequest, err)
+			return
+		}
+		if err != nil {
+			writeResourceError(rw, http.StatusInternalServerError, err)
+			return
+		}
+		writeResourceJSON(rw, http.StatusOK, value)
+	}
+}
+
+func writeResourceError(rw http.ResponseWriter, status int, err error) {
+	writeResourceJSON(rw, status, map[string]string{"error": err.Error()})
+}
+
+func writeResourceJSON(rw http.ResponseWriter, status int, value interface{}) {
+	body, err := json.Marshal(value)
+	if err != nil {
+		status = http.StatusInternalServerError
+		body = []byte(`{"error":"Error. Failed to encode response"}`)
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(status)
+	_, _ = rw.Write(body)
+}
+
+// ListCatalogs lists the data catalogs of the account
+func (handler *AwsAthenaQueryHandler) ListCatalogs(ctx context.Context, opt *AthenaDatasourceQueryOption) ([]string, error) {
+	value, err := handler.cachedResource(ctx, opt, []string{"catalogs"}, func(athenaSvc *athena.Client) (interface{}, error) {
+		catalogs := make([]string, 0)
+		paginator := athena.NewListDataCatalogsPaginator(athenaSvc, &athena.ListDataCatalogsInput{})
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(ctx)
+			if err != nil {
+				return nil, err
+			}
+			for _, catalog := range page.DataCatalogsSummary {
+				if catalog.CatalogName != nil {
+					catalogs = append(catalogs, *catalog.CatalogName)
+				}
+			}
+		}
+		return catalogs, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value.([]string), nil
+}
+
+// ListDatabases lists the databases of a data catalog
+func (handler *AwsAthenaQueryHandler) ListDatabases(ctx context.Context, opt *AthenaDatasourceQueryOption, catalog string) ([]string, error) {
+	value, err := handler.cachedResource(ctx, opt, []string{"databases", catalog}, func(athenaSvc *athena.Client) (interface{}, error) {
+		databases := make([]string, 0)
+		paginator := athena.NewListDatabasesPaginator(athenaSvc, &athena.ListDatabasesInput{
+			CatalogName: &catalog,
+		})
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(ctx)
+			if err != nil {
+				return nil, err
+			}
+			for _, database := range page.DatabaseList {
+				if database.Name != nil {
+					databases = append(databases, *database.Name)
+				}
+			}
+		}
+		return databases, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value.([]string), nil
+}
+
+// ListTables lists the tables of a database
+func (handler *AwsAthenaQueryHandler) ListTables(ctx context.Context, opt *AthenaDatasourceQueryOption, catalog string, database string) ([]string, error) {
+	value, err := handler.cachedResource(ctx, opt, []string{"tables", catalog, database}, func(athenaSvc *athena.Client) (interface{}, error) {
+		tables := make([]string, 0)
+		paginator := athena.NewListTableMetadataPaginator(athenaSvc, &athena.ListTableMetadataInput{
+			CatalogName:  &catalog,
+			DatabaseName: &database,
+		})
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(ctx)
+			if err != nil {
+				return nil, err
+			}
+			for _, table := range page.TableMetadataList {
+				if table.Name != nil {
+					tables = append(tables, *table.Name)
+				}
+			}
+		}
+		return tables, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value.([]string), nil
+}
+
+// ListColumns lists the columns and partition keys of a table
+func (handler *AwsAthenaQueryHandler) ListColumns(ctx context.Context, opt *AthenaDatasourceQueryOption, catalog string, database string, table string) ([]TableColumn, error) {
+	value, err := handler.cachedResource(ctx, opt, []string{"columns", catalog, database, table}, func(athenaSvc *athena.Client) (interface{}, error) {
+		res, err := athenaSvc.GetTableMetadata(ctx, &athena.GetTableMetadataInput{
+			CatalogName:  &catalog,
+			DatabaseName: &database,
+			TableName:    &table,
+		})
+		if err != nil {
+			return nil, err
+		}
+		columns := make([]TableColumn, 0)
+		if res.TableMetadata == nil {
+			return columns, nil
+		}
+		for _, column := range res.TableMetadata.Columns {
+			columns = append(columns, newTableColumn(column.Name, column.Type, column.Comment, false))
+		}
+		for _, column := range res.TableMetadata.PartitionKeys {
+			columns = append(columns, newTableColumn(column.Name, column.Type, column.Comment, true))
+		}
+		return columns, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value.([]TableColumn), nil
+}
+
+// ListPreparedStatements lists the prepared statements of the workgroup
+func (handler *AwsAthenaQueryHandler) ListPreparedStatements(ctx context.Context, opt *AthenaDatasourceQueryOption) ([]string, error) {
+	value, err := handler.cachedResource(ctx, opt, []string{"prepared-statements", opt.WorkGroup}, func(athenaSvc *athena.Client) (interface{}, error) {
+		statements := make([]string, 0)
+		paginator := athena.NewListPreparedStatementsPaginator(athenaSvc, &athena.ListPreparedStatementsInput{
+			WorkGroup: &opt.WorkGroup,
+		})
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(ctx)
+			if err != nil {
+				return nil, err
+			}
+			for _, statement := range page.PreparedStatements {
+				if statement.StatementName != nil {
+					statements = append(statements, *statement.StatementName)
+				}
+			}
+		}
+		return statements, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value.([]string), nil
+}
+
+// cachedResource returns a cached resource listing or fetches it with a new athena client
+func (handler *AwsAthenaQueryHandler) cachedResource(ctx context.Context, opt *AthenaDatasourceQueryOption, path []string, fetch func(athenaSvc *athena.Client) (interface{}, error)) (interface{}, error) {
+	// listings depend on the account and region the settings resolve to
+	cacheKey := strings.Join(append([]string{opt.DatasourceUID, string(opt.AuthType), opt.AccessKey, string(opt.RoleARN), opt.Region}, path...), "/")
+
+	handler.cacheLock.Lock()
+	if info, ok := handler.resourceCache[cacheKey]; ok && !info.IsExpired() {
+		handler.cacheLock.Unlock()
+		return info.Value, nil
+	}
+	handler.cacheLock.Unlock()
+
+	cfg, err := GetAwsConfig(ctx, opt)
+	if err != nil {
+		return nil, err
+	}
+	value, err := fetch(athena.NewFromConfig(cfg))
+	if err != nil {
+		return nil, err
+	}
+
+	handler.cacheLock.Lock()
+	defer handler.cacheLock.Unlock()
+	for k, v := range handler.resourceCache {
+		if v.IsExpired() {
+			delete(handler.resourceCache, k)
+		}
+	}
+	handler.resourceCache[cacheKey] = &ResourceCacheInfo{
+		Value:          value,
+		ExpirationTime: time.Now().Add(ResourceCacheExpiryTime),
+	}
+	return value, nil
+}
+
+func newTableColumn(name *string, colType *string, comment *string, partition bool) TableColumn {
+	column := TableColumn{Partition: partition}
+	if name != nil {
+		column.Name = *name
+	}
+	if colType != nil {
+		column.Type = *colType
+	}
+	if comment != nil {
+		column.Comment = *comment
+	}
+	return column
+}
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// aggregateDuplicatePoints merges points sharing a timestamp, points must be sorted by timestamp
+func aggregateDuplicatePoints(points []*Point, agg AggregationType) ([]*Point, error) {
+	aggregated := make([]*Point, 0, len(points))
+	for start := 0; start < len(points); {
+		end := start + 1
+		for end < len(points) && points[end].Timestamp == points[start].Timestamp {
+			end++
+		}
+		values := make([]float64, 0, end-start)
+		for _, p := range points[start:end] {
+			values = append(values, p.Value)
+		}
+		value, err := aggregateValues(values, agg)
+		if err != nil {
+			return nil, err
+		}
+		aggregated = append(aggregated, &Point{
+			Timestamp: points[start].Timestamp,
+			Value:     value,
+		})
+		start = end
+	}
+	return aggregated, nil
+}
+
+func aggregateValues(values []float64, agg AggregationType) (float64, error) {
+	if len(values) == 0 {
+		return math.NaN(), nil
+	}
+	switch agg {
+	case AggregationSum, AggregationAvg:
+		sum := 0.0
+		for _, v := range values {
+			sum += v
+		}
+		if agg == AggregationAvg {
+			return sum / float64(len(values)), nil
+		}
+		return sum, nil
+	case AggregationMin:
+		min := values[0]
+		for _, v := range values[1:] {
+			min = math.Min(min, v)
+		}
+		return min, nil
+	case AggregationMax:
+		max := values[0]
+		for _, v := range values[1:] {
+			max = math.Max(max, v)
+		}
+		return max, nil
+	case AggregationLast:
+		return values[len(values)-1], nil
+	case AggregationCount:
+		return float64(len(values)), nil
+	default:
+		return 0, fmt.Errorf("Unexpected aggregation type %s", agg)
+	}
+}
+
+// fillGaps inserts points every opt.IntervalMs where a series has no data within opt.From and opt.To,
+// points must be sorted by timestamp. Null points are sent as NaN.
+func fillGaps(points []*Point, opt *AthenaDatasourceQueryOption) ([]*Point, error) {
+	switch opt.Fill {
+	case FillNull, FillZero, FillPrevious, FillLinear:
+	default:
+		return nil, fmt.Errorf("Unexpected fill mode %s", opt.Fill)
+	}
+	interval := opt.IntervalMs
+	if interval <= 0 || len(points) == 0 {
+		return points, nil
+	}
+	from := opt.From.UnixNano() / int64(time.Millisecond)
+	to := opt.To.UnixNano() / int64(time.Millisecond)
+	if (to-from)/interval > FillMaxPoints {
+		return nil, fmt.Errorf("Error. Filling every %dms would exceed %d points", interval, FillMaxPoints)
+	}
+
+	filled := make([]*Point, 0, len(points))
+	// leading gap, nothing to carry over or interpolate from
+	first := points[0].Timestamp
+	for ts := first - (first-from)/interval*interval; ts < first; ts += interval {
+		filled = append(filled, &Point{Timestamp: ts, Value: fillValue(opt.Fill, nil, nil, ts)})
+	}
+	for i, p := range points {
+		filled = append(filled, p)
+		var next *Point
+		end := to + 1
+		if i+1 < len(points) {
+			next = points[i+1]
+			end = next.Timestamp
+		}
+		for ts := p.Timestamp + interval; ts < end; ts += interval {
+			filled = append(filled, &Point{Timestamp: ts, Value: fillValue(opt.Fill, p, next, ts)})
+		}
+	}
+	return filled, nil
+}
+
+func fillValue(mode FillMode, prev *Point, next *Point, ts int64) float64 {
+	switch mode {
+	case FillZero:
+		return 0
+	case FillPrevious:
+		if prev != nil {
+			return prev.Value
+		}
+	case FillLinear:
+		if prev != nil && next != nil {
+			ratio := float64(ts-prev.Timestamp) / float64(next.Timestamp-prev.Timestamp)
+			return prev.Value + (next.Value-prev.Value)*ratio
+		}
+	}
+	return math.NaN()
+}
+
+// downsample reduces points to at most opt.MaxDataPoints, points must be sorted by timestamp.
+// Null points of filled gaps only make a point of their own where a bucket has no data.
+func downsample(points []*Point, opt *AthenaDatasourceQueryOption) ([]*Point, error) {
+	var agg AggregationType
+	switch opt.Downsample {
+	case DownsampleAvg:
+		agg = AggregationAvg
+	case DownsampleMin:
+		agg = AggregationMin
+	case DownsampleMax:
+		agg = AggregationMax
+	case DownsampleLTTB:
+	default:
+		return nil, fmt.Errorf("Unexpected downsample type %s", opt.Downsample)
+	}
+	threshold := int(opt.MaxDataPoints)
+	if threshold <= 0 || len(points) <= threshold {
+		return points, nil
+	}
+	if opt.Downsample == DownsampleLTTB {
+		return largestTriangleThreeBuckets(points, threshold), nil
+	}
+
+	// bucket by time so that buckets line up across series
+	from := points[0].Timestamp
+	width := (points[len(points)-1].Timestamp-from)/int64(threshold) + 1
+	if width < opt.IntervalMs {
+		width = opt.IntervalMs
+	}
+	sampled := make([]*Point, 0, threshold)
+	values := make([]float64, 0)
+	bucket := int64(0)
+	filled := false
+	flush := func() error {
+		if len(values) == 0 {
+			if filled {
+				// a bucket of null fill points stays a gap
+				sampled = append(sampled, &Point{Timestamp: from + bucket*width, Value: math.NaN()})
+			}
+			return nil
+		}
+		value, err := aggregateValues(values, agg)
+		if err != nil {
+			return err
+		}
+		sampled = append(sampled, &Point{Timestamp: from + bucket*width, Value: value})
+		values = values[:0]
+		return nil
+	}
+	for _, p := range points {
+		if b := (p.Timestamp - from) / width; b != bucket {
+			if err := flush(); err != nil {
+				return nil, err
+			}
+			bucket = b
+			filled = false
+		}
+		if math.IsNaN(p.Value) {
+			filled = true
+			continue
+		}
+		values = append(values, p.Value)
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return sampled, nil
+}
+
+// largestTriangleThreeBuckets keeps the points that best preserve the visual shape of the series
+func largestTriangleThreeBuckets(points []*Point, threshold int) []*Point {
+	if threshold < 3 {
+		// no bucket between the ends, the ends keep the time range of the series
+		return []*Point{points[0], points[len(points)-1]}
+	}
+	sampled := make([]*Point, 0, threshold)
+	sampled = append(sampled, points[0])
+	every := float64(len(points)-2) / float64(threshold-2)
+	prev := 0
+	for i := 0; i < threshold-2; i++ {
+		// average of the next bucket is the third triangle vertex
+		nextStart := int(float64(i+1)*every) + 1
+		nextEnd := int(float64(i+2)*every) + 1
+		if nextEnd > len(points) {
+			nextEnd = len(points)
+		}
+		avgX, avgY := 0.0, 0.0
+		count := 0.0
+		for _, p := range points[nextStart:nextEnd] {
+			// null fill points have no height, they are kept only where a bucket has no data
+			if math.IsNaN(p.Value) {
+				continue
+			}
+			avgX += float64(p.Timestamp)
+			avgY += p.Value
+			count++
+		}
+		if count > 0 {
+			avgX /= count
+			avgY /= count
+		} else {
+			avgX, avgY = float64(points[nextStart].Timestamp), points[prev].Value
+		}
+		prevValue := points[prev].Value
+		if math.IsNaN(prevValue) {
+			prevValue = avgY
+		}
+
+		start := int(float64(i)*every) + 1
+		end := nextStart
+		maxArea := -1.0
+		selected := start
+		for j := start; j < end; j++ {
+			if math.IsNaN(points[j].Value) {
+				continue
+			}
+			area := math.Abs((float64(points[prev].Timestamp)-avgX)*(points[j].Value-prevValue) -
+				(float64(points[prev].Timestamp)-float64(points[j].Timestamp))*(avgY-prevValue))
+			if area > maxArea {
+				maxArea = area
+				selected = j
+			}
+		}
+		sampled = append(sampled, points[selected])
+		if !math.IsNaN(points[selected].Value) {
+			prev = selected
+		}
+	}
+	return append(sampled, points[len(points)-1])
+}
+
+// sortAndLimitSeries orders series by opt.SortBy, name by default, and keeps the first opt.Limit of them.
+// Value based orders are descending so that the limit keeps the largest series.
+func sortAndLimitSeries(series []*Series, opt *AthenaDatasourceQueryOption) ([]*Series, error) {
+	var score func(points []*Point) float64
+	switch opt.SortBy {
+	case "", SortByName:
+	case SortByTotal:
+		score = func(points []*Point) float64 {
+			total := 0.0
+			for _, p := range points {
+				if !math.IsNaN(p.Value) {
+					total += p.Value
+				}
+			}
+			return total
+		}
+	case SortByMax:
+		score = func(points []*Point) float64 {
+			max := math.Inf(-1)
+			for _, p := range points {
+				if !math.IsNaN(p.Value) {
+					max = math.Max(max, p.Value)
+				}
+			}
+			return max
+		}
+	case SortByLast:
+		score = func(points []*Point) float64 {
+			for i := len(points) - 1; i >= 0; i-- {
+				if !math.IsNaN(points[i].Value) {
+					return points[i].Value
+				}
+			}
+			return math.Inf(-1)
+		}
+	default:
+		return nil, fmt.Errorf("Unexpected sort type %s", opt.SortBy)
+	}
+
+	scores := make(map[*Series]float64, len(series))
+	if score != nil {
+		for _, serie := range series {
+			scores[serie] = score(serie.Points)
+		}
+	}
+	sort.SliceStable(series, func(i int, j int) bool {
+		if scores[series[i]] != scores[series[j]] {
+			return scores[series[i]] > scores[series[j]]
+		}
+		return series[i].Name < series[j].Name
+	})
+
+	if opt.Limit <= 0 || len(series) <= opt.Limit {
+		return series, nil
+	}
+	limited := series[:opt.Limit]
+	if opt.ShowOther {
+		limited = append(limited, sumSeries(OtherSeriesName, series[opt.Limit:]))
+	}
+	return limited, nil
+}
+
+// sumSeries adds up the points of all series per timestamp
+func sumSeries(name string, series []*Series) *Series {
+	sums := make(map[int64]float64)
+	for _, serie := range series {
+		for _, p := range serie.Points {
+			value := p.Value
+			if math.IsNaN(value) {
+				value = 0
+			}
+			sums[p.Timestamp] += value
+		}
+	}
+	sum := &Series{
+		Name:   name,
+		Labels: make(map[string]string),
+		Points: make([]*Point, 0, len(sums)),
+	}
+	for ts, value := range sums {
+		sum.Points = append(sum.Points, &Point{Timestamp: ts, Value: value})
+	}
+	sort.Slice(sum.Points, func(i int, j int) bool {
+		return sum.Points[i].Timestamp < sum.Points[j].Timestamp
+	})
+	return sum
+}
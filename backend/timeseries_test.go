@@ -0,0 +1,205 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+// seriesPoints builds points one second apart from values, NaN for nulls
+func seriesPoints(values ...float64) []*Point {
+	points := make([]*Point, len(values))
+	for i, value := range values {
+		points[i] = &Point{Timestamp: int64(i) * 1000, Value: value}
+	}
+	return points
+}
+
+// formatPoints lists points as timestamp:value
+func formatPoints(points []*Point) string {
+	parts := make([]string, len(points))
+	for i, p := range points {
+		parts[i] = fmt.Sprintf("%d:%v", p.Timestamp, p.Value)
+	}
+	return strings.Join(parts, " ")
+}
+
+func TestDownsample(t *testing.T) {
+	nan := math.NaN()
+	tests := []struct {
+		name          string
+		downsample    DownsampleType
+		maxDataPoints int64
+		intervalMs    int64
+		points        []*Point
+		want          string
+		err           string
+	}{
+		{"within max data points", DownsampleAvg, 10, 1000, seriesPoints(1, 2, 3), "0:1 1000:2 2000:3", ""},
+		{"no max data points", DownsampleAvg, 0, 1000, seriesPoints(1, 2, 3), "0:1 1000:2 2000:3", ""},
+		{"avg", DownsampleAvg, 5, 1000, seriesPoints(0, 1, 2, 3, 4, 5, 6, 7, 8, 9), "0:0.5 1801:2.5 3602:4.5 5403:6.5 7204:8.5", ""},
+		{"min", DownsampleMin, 5, 1000, seriesPoints(0, 1, 2, 3, 4, 5, 6, 7, 8, 9), "0:0 1801:2 3602:4 5403:6 7204:8", ""},
+		{"max", DownsampleMax, 5, 1000, seriesPoints(0, 1, 2, 3, 4, 5, 6, 7, 8, 9), "0:1 1801:3 3602:5 5403:7 7204:9", ""},
+		{"buckets at least the interval", DownsampleAvg, 5, 3000, seriesPoints(0, 1, 2, 3, 4, 5, 6, 7, 8, 9), "0:1 3000:4 6000:7 9000:9", ""},
+		{"nulls skipped", DownsampleAvg, 5, 1000, seriesPoints(0, 1, 2, 3, 4, nan, nan, 7, 8, 9), "0:0.5 1801:2.5 3602:4 5403:7 7204:8.5", ""},
+		{"null bucket stays a gap", DownsampleAvg, 5, 1000, seriesPoints(0, 1, 2, 3, nan, nan, 6, 7, 8, 9), "0:0.5 1801:2.5 3602:NaN 5403:6.5 7204:8.5", ""},
+		{"lttb keeps peaks", DownsampleLTTB, 3, 1000, seriesPoints(0, 0, 0, 10, 0, 0, 0), "0:0 3000:10 6000:0", ""},
+		{"lttb null bucket stays a gap", DownsampleLTTB, 3, 1000, seriesPoints(1, nan, nan, nan, nan, nan, 1), "0:1 1000:NaN 6000:1", ""},
+		{"lttb below three points keeps the ends", DownsampleLTTB, 2, 1000, seriesPoints(0, 1, 2, 3, 4), "0:0 4000:4", ""},
+		{"unknown", DownsampleType("median"), 5, 1000, seriesPoints(1), "", "Unexpected downsample type"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opt := &AthenaDatasourceQueryOption{Downsample: tt.downsample, MaxDataPoints: tt.maxDataPoints, IntervalMs: tt.intervalMs}
+			got, err := downsample(tt.points, opt)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("downsample error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("downsample error = %v", err)
+			}
+			if formatPoints(got) != tt.want {
+				t.Errorf("downsample = %s, want %s", formatPoints(got), tt.want)
+			}
+		})
+	}
+}
+
+func TestLargestTriangleThreeBucketsLength(t *testing.T) {
+	points := make([]*Point, 1000)
+	for i := range points {
+		points[i] = &Point{Timestamp: int64(i) * 1000, Value: math.Sin(float64(i) / 10)}
+	}
+	for _, threshold := range []int{3, 10, 100, 999} {
+		sampled := largestTriangleThreeBuckets(points, threshold)
+		if len(sampled) != threshold {
+			t.Errorf("largestTriangleThreeBuckets(%d) kept %d points", threshold, len(sampled))
+		}
+		if sampled[0] != points[0] || sampled[len(sampled)-1] != points[len(points)-1] {
+			t.Errorf("largestTriangleThreeBuckets(%d) did not keep the ends", threshold)
+		}
+		for i := 1; i < len(sampled); i++ {
+			if sampled[i].Timestamp <= sampled[i-1].Timestamp {
+				t.Fatalf("largestTriangleThreeBuckets(%d) is not ordered at %d", threshold, i)
+			}
+		}
+	}
+}
+
+func TestFillGaps(t *testing.T) {
+	tests := []struct {
+		name       string
+		fill       FillMode
+		from       int64
+		to         int64
+		intervalMs int64
+		want       string
+		err        string
+	}{
+		{"null", FillNull, 0, 6000, 1000, "0:NaN 1000:NaN 2000:2 3000:NaN 4000:6 5000:NaN 6000:NaN", ""},
+		{"zero", FillZero, 0, 6000, 1000, "0:0 1000:0 2000:2 3000:0 4000:6 5000:0 6000:0", ""},
+		{"previous", FillPrevious, 0, 6000, 1000, "0:NaN 1000:NaN 2000:2 3000:2 4000:6 5000:6 6000:6", ""},
+		{"linear", FillLinear, 0, 6000, 1000, "0:NaN 1000:NaN 2000:2 3000:4 4000:6 5000:NaN 6000:NaN", ""},
+		{"leading gap aligned to the points", FillZero, 500, 4000, 1000, "1000:0 2000:2 3000:0 4000:6", ""},
+		{"no trailing gap", FillZero, 2000, 4500, 1000, "2000:2 3000:0 4000:6", ""},
+		{"no interval", FillZero, 0, 6000, 0, "2000:2 4000:6", ""},
+		{"too many points", FillZero, 0, 1000000, 1, "", "would exceed"},
+		{"unknown", FillMode("spline"), 0, 6000, 1000, "", "Unexpected fill mode"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opt := &AthenaDatasourceQueryOption{
+				Fill:       tt.fill,
+				From:       time.Unix(0, tt.from*int64(time.Millisecond)),
+				To:         time.Unix(0, tt.to*int64(time.Millisecond)),
+				IntervalMs: tt.intervalMs,
+			}
+			points := []*Point{{Timestamp: 2000, Value: 2}, {Timestamp: 4000, Value: 6}}
+			got, err := fillGaps(points, opt)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("fillGaps error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("fillGaps error = %v", err)
+			}
+			if formatPoints(got) != tt.want {
+				t.Errorf("fillGaps = %s, want %s", formatPoints(got), tt.want)
+			}
+		})
+	}
+}
+
+func TestSortAndLimitSeries(t *testing.T) {
+	nan := math.NaN()
+	tests := []struct {
+		name      string
+		sortBy    SortType
+		limit     int
+		showOther bool
+		want      string
+		err       string
+	}{
+		{"default", "", 0, false, "a b c d", ""},
+		{"name", SortByName, 0, false, "a b c d", ""},
+		{"total ties by name", SortByTotal, 0, false, "a c b d", ""},
+		{"max", SortByMax, 0, false, "c a b d", ""},
+		{"last skips nulls", SortByLast, 0, false, "a b c d", ""},
+		{"limit", SortByTotal, 2, false, "a c", ""},
+		{"limit above series", SortByTotal, 5, true, "a c b d", ""},
+		{"other", SortByTotal, 2, true, "a c other[0:4 1000:0]", ""},
+		{"unknown", SortType("median"), 0, false, "", "Unexpected sort type"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			series := []*Series{
+				{Name: "d", Points: []*Point{{Timestamp: 0, Value: nan}, {Timestamp: 1000, Value: nan}}},
+				{Name: "c", Points: []*Point{{Timestamp: 0, Value: 6}, {Timestamp: 1000, Value: 0}}},
+				{Name: "b", Points: []*Point{{Timestamp: 0, Value: 4}, {Timestamp: 1000, Value: nan}}},
+				{Name: "a", Points: []*Point{{Timestamp: 0, Value: 1}, {Timestamp: 1000, Value: 5}}},
+			}
+			opt := &AthenaDatasourceQueryOption{SortBy: tt.sortBy, Limit: tt.limit, ShowOther: tt.showOther}
+			got, err := sortAndLimitSeries(series, opt)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("sortAndLimitSeries error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("sortAndLimitSeries error = %v", err)
+			}
+			names := make([]string, len(got))
+			for i, serie := range got {
+				names[i] = serie.Name
+				if serie.Name == OtherSeriesName {
+					names[i] += "[" + formatPoints(serie.Points) + "]"
+				}
+			}
+			if strings.Join(names, " ") != tt.want {
+				t.Errorf("sortAndLimitSeries = %s, want %s", strings.Join(names, " "), tt.want)
+			}
+		})
+	}
+}
+
+func TestSumSeries(t *testing.T) {
+	series := []*Series{
+		{Name: "a", Points: []*Point{{Timestamp: 2000, Value: 1}, {Timestamp: 0, Value: 2}}},
+		{Name: "b", Points: []*Point{{Timestamp: 0, Value: 3}, {Timestamp: 1000, Value: math.NaN()}}},
+	}
+	sum := sumSeries("total", series)
+	if sum.Name != "total" || sum.Labels == nil {
+		t.Errorf("sumSeries name = %q, labels = %v", sum.Name, sum.Labels)
+	}
+	if got, want := formatPoints(sum.Points), "0:5 1000:0 2000:1"; got != want {
+		t.Errorf("sumSeries = %s, want %s", got, want)
+	}
+}
@@ -3,16 +3,12 @@ package main
 import (
 	"time"
 
-	"github.com/grafana/grafana-plugin-model/go/datasource"
-
-	hclog "github.com/hashicorp/go-hclog"
-	plugin "github.com/hashicorp/go-plugin"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
 )
 
 // AwsAthenaDatasource plugin datasource
 type AwsAthenaDatasource struct {
-	plugin.NetRPCUnsupportedPlugin
-	logger hclog.Logger
+	logger log.Logger
 	athena IAwsAthenaQueryHandler
 }
 
@@ -23,9 +19,12 @@ type AthenaDatasourceQueryOption struct {
 	WorkGroup    string     `json:"workGroup"`
 	TimeColumn   string     `json:"timeColumn"`
 	NamedQuery   string     `json:"namedQuery"`
+	QueryString  string     `json:"queryString"`
 	ExecutionID  string     `json:"executionId"`
 	MetricColumn string     `json:"metricColumn"`
 	ValueColumns string     `json:"valueColumns"`
+	LabelColumns string     `json:"labelColumns"`
+	Alias        string     `json:"alias"`
 	UseCache     bool       `json:"useCache"`
 	Format       FormatType `json:"format"`
 	AuthType     AuthType   `json:"authType"`
@@ -33,33 +32,189 @@ type AthenaDatasourceQueryOption struct {
 	Region       string     `json:"region"`
 	AccessKey    string     `json:"accessKey"`
 	SecretKey    string
-	From         time.Time
-	To           time.Time
+	// DatasourceUID scopes the caches to the datasource instance, set from the datasource settings only
+	DatasourceUID string `json:"-"`
+	QueryTimeout  int    `json:"queryTimeout"`
+	From          time.Time
+	To            time.Time
+	IntervalMs    int64
+
+	// PreserveDecimals keeps high precision decimals as exact strings in tables
+	PreserveDecimals bool `json:"preserveDecimals"`
+	// Aggregation merges points of a series sharing a timestamp
+	Aggregation AggregationType `json:"aggregation"`
+	// Fill inserts points for missing intervals of a series
+	Fill FillMode `json:"fill"`
+	// Downsample reduces series longer than MaxDataPoints
+	Downsample    DownsampleType `json:"downsample"`
+	MaxDataPoints int64
+	// SortBy orders series, Limit keeps the first N of them
+	SortBy    SortType `json:"sortBy"`
+	Limit     int      `json:"limit"`
+	ShowOther bool     `json:"showOther"`
+	// MessageColumn and LevelColumn are used by the logs format
+	MessageColumn string `json:"messageColumn"`
+	LevelColumn   string `json:"levelColumn"`
+	// TimeEndColumn, TitleColumn, TextColumn and TagsColumn are used by the annotations format
+	TimeEndColumn string `json:"timeEndColumn"`
+	TitleColumn   string `json:"titleColumn"`
+	TextColumn    string `json:"textColumn"`
+	TagsColumn    string `json:"tagsColumn"`
+	// BucketColumn and CountColumn are used by the heatmap format
+	BucketColumn string `json:"bucketColumn"`
+	CountColumn  string `json:"countColumn"`
+	// Catalog and Database of the query override the datasource defaults for the query execution context
+	Catalog         string `json:"catalog"`
+	Database        string `json:"database"`
+	DefaultCatalog  string `json:"defaultCatalog"`
+	DefaultDatabase string `json:"defaultDatabase"`
+	// Variables holds the values of the dashboard template variables by name
+	Variables map[string][]string `json:"variables"`
+	// Parameters are the values of the ? placeholders of the query, in order
+	Parameters []QueryParameter `json:"parameters"`
+	// PreparedStatement is the name of the prepared statement of the workgroup to execute
+	PreparedStatement string `json:"preparedStatement"`
+	// AdhocFilters of the dashboard are applied to named and raw queries
+	AdhocFilters []AdhocFilter `json:"adhocFilters"`
+	// Builder is the structured query of the visual query builder
+	Builder *QueryBuilder `json:"builder"`
+	// MaxBytesScanned stops queries scanning more, 0 for no limit. Datasource setting only, like PricePerTB
+	MaxBytesScanned int64   `json:"maxBytesScanned"`
+	PricePerTB      float64 `json:"pricePerTB"`
+}
+
+// QueryBuilder is a structured query compiled into athena sql
+type QueryBuilder struct {
+	Table string `json:"table"`
+	// TimeColumn is filtered by the time range and grouped into Interval buckets, e.g. 5m, the query interval if empty
+	TimeColumn string `json:"timeColumn"`
+	Interval   string `json:"interval"`
+	// PartitionColumns are the arguments of $__partitionFilter, e.g. year, month, day
+	PartitionColumns string          `json:"partitionColumns"`
+	Columns          []BuilderColumn `json:"columns"`
+	GroupBy          []string        `json:"groupBy"`
+	Filters          []BuilderFilter `json:"filters"`
+	OrderBy          []BuilderOrder  `json:"orderBy"`
+	Limit            int             `json:"limit"`
+}
+
+// BuilderColumn is a selected column, aggregated by Aggregation unless empty
+type BuilderColumn struct {
+	Column      string `json:"column"`
+	Aggregation string `json:"aggregation"`
+	Alias       string `json:"alias"`
+}
+
+// BuilderFilter is a condition on a column, Value may be a variable reference and is formatted as a literal of Type
+type BuilderFilter struct {
+	Column   string        `json:"column"`
+	Operator string        `json:"operator"`
+	Value    string        `json:"value"`
+	Type     ParameterType `json:"type"`
+}
+
+// BuilderOrder orders by a column or alias
+type BuilderOrder struct {
+	Column string `json:"column"`
+	Desc   bool   `json:"desc"`
+}
+
+// AdhocFilter is a key, operator and value of a dashboard ad-hoc filter
+type AdhocFilter struct {
+	Key      string `json:"key"`
+	Operator string `json:"operator"`
+	Value    string `json:"value"`
+}
+
+// QueryParameter is a literal, a variable reference or a time range value of an execution parameter
+type QueryParameter struct {
+	Value string        `json:"value"`
+	Type  ParameterType `json:"type"`
 }
 
 //ColumnInfo ...
 type ColumnInfo struct {
-	Type       datasource.RowValue_Kind `json:"colType"`
-	ColumnName string                   `json:"colName"`
+	Type       ColumnKind `json:"colType"`
+	ColumnName string     `json:"colName"`
+	TypeName   string     `json:"typeName"`
+	Precision  int64      `json:"precision"`
+	Scale      int64      `json:"scale"`
+	Nullable   bool       `json:"nullable"`
+	IsTime     bool       `json:"isTime"`
+}
+
+// ExecutionStats describes the athena query execution a result was read from
+type ExecutionStats struct {
+	ExecutionID           string `json:"executionId"`
+	DataScannedBytes      int64  `json:"dataScannedBytes"`
+	EngineExecutionTimeMs int64  `json:"engineExecutionTimeMs"`
+	QueryQueueTimeMs      int64  `json:"queryQueueTimeMs"`
+	TotalExecutionTimeMs  int64  `json:"totalExecutionTimeMs"`
+	CacheHit              bool   `json:"cacheHit"`
+	// EstimatedCost in dollars of reading the result, as athena bills scanned bytes. Results of an earlier
+	// execution cost nothing, OriginalCost is what their execution cost when it ran
+	EstimatedCost float64 `json:"estimatedCost"`
+	OriginalCost  float64 `json:"originalCost"`
+	// Query is the sql athena executed, after interpolation and macros
+	Query string `json:"query"`
 }
 
 //QueryResultMetadata ...
 type QueryResultMetadata struct {
 	ColumnInfos []ColumnInfo `json:"colInfos"`
+	*ExecutionStats
 }
 
+// ColumnKind ...
+type ColumnKind int32
+
 // QueryType ...
 type QueryType string
 
+// ParameterType ...
+type ParameterType string
+
+// VariableFormatType ...
+type VariableFormatType string
+
 // AuthType ...
 type AuthType string
 
 // FormatType ...
 type FormatType string
 
+// AggregationType ...
+type AggregationType string
+
+// FillMode ...
+type FillMode string
+
+// DownsampleType ...
+type DownsampleType string
+
+// SortType ...
+type SortType string
+
 // AthenaQueryResult ...
 type AthenaQueryResult struct {
 	ColumnInfoMap map[int]*ColumnInfo
 	Rows          [][]string
 	Opt           *AthenaDatasourceQueryOption
+	// Stats of the execution, nil for results not read from athena
+	Stats *ExecutionStats
+	// Truncated is set when the execution has more than MaxResultRows rows
+	Truncated bool
+}
+
+// Series ...
+type Series struct {
+	Name   string
+	Labels map[string]string
+	Points []*Point
+}
+
+// Point ...
+type Point struct {
+	Timestamp int64
+	Value     float64
 }
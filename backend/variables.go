@@ -0,0 +1,188 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// variablePattern matches $name, ${name}, ${name:format}, [[name]] and [[name:format]]
+var variablePattern = regexp.MustCompile(`\$(\w+)|\$\{(\w+)(?::(\w+))?\}|\[\[(\w+)(?::(\w+))?\]\]`)
+
+// interpolateVariables substitutes the template variables sent with the query into sql,
+// names without a value are left for athena or later macros and references in comments are kept as they are
+func interpolateVariables(sql string, variables map[string][]string) (string, error) {
+	if len(variables) == 0 {
+		return sql, nil
+	}
+	contexts := sqlContexts(sql)
+	var result strings.Builder
+	last := 0
+	for _, loc := range variablePattern.FindAllStringSubmatchIndex(sql, -1) {
+		groups := make([]string, len(loc)/2)
+		for i := range groups {
+			if loc[2*i] >= 0 {
+				groups[i] = sql[loc[2*i]:loc[2*i+1]]
+			}
+		}
+		name, format := variableReference(groups)
+		values, ok := variables[name]
+		if !ok || contexts[loc[0]] == sqlContextComment {
+			continue
+		}
+		formatted, err := formatVariable(values, format, contexts[loc[0]])
+		if err != nil {
+			return "", fmt.Errorf("Error. Variable %s: %v", name, err)
+		}
+		result.WriteString(sql[last:loc[0]])
+		result.WriteString(formatted)
+		last = loc[1]
+	}
+	result.WriteString(sql[last:])
+	return result.String(), nil
+}
+
+// variableReference returns the name and format of a variablePattern match
+func variableReference(groups []string) (string, VariableFormatType) {
+	switch {
+	case groups[2] != "":
+		return groups[2], VariableFormatType(groups[3])
+	case groups[4] != "":
+		return groups[4], VariableFormatType(groups[5])
+	default:
+		return groups[1], VariableFormatNone
+	}
+}
+
+// formatVariable formats the values of a variable for where the reference is in the query.
+// Values are escaped so they cannot end a quoted literal or identifier of the query, csv values outside
+// of literals must be numbers and no format gives quoted sql strings. The raw format inserts the values
+// unescaped, it is only safe for values the dashboard author controls.
+func formatVariable(values []string, format VariableFormatType, context sqlContext) (string, error) {
+	for _, value := range values {
+		// NUL marks the macros of the query while variables are interpolated
+		if strings.ContainsRune(value, 0) {
+			return "", fmt.Errorf("invalid character in value")
+		}
+	}
+	switch format {
+	case VariableFormatRaw:
+		return strings.Join(values, ","), nil
+	case VariableFormatNone, VariableFormatSQLString, VariableFormatCSV, VariableFormatRegex:
+	default:
+		return "", fmt.Errorf("unknown format %s", format)
+	}
+
+	switch context {
+	case sqlContextString:
+		// the query quotes the value already, e.g. '$host'
+		if format == VariableFormatRegex {
+			return quoteString(regexValue(values)), nil
+		}
+		if format != VariableFormatCSV && len(values) != 1 {
+			return "", fmt.Errorf("%d values in a quoted string, use ${name:csv} or an unquoted reference", len(values))
+		}
+		return quoteString(strings.Join(values, ",")), nil
+	case sqlContextIdentifier:
+		if len(values) != 1 {
+			return "", fmt.Errorf("%d values in a quoted identifier", len(values))
+		}
+		return strings.ReplaceAll(values[0], `"`, `""`), nil
+	}
+
+	if len(values) == 0 {
+		// nothing would be left of the reference, e.g. IN () is invalid sql
+		return "", fmt.Errorf("no values")
+	}
+	switch format {
+	case VariableFormatCSV:
+		for _, value := range values {
+			if !numberPattern.MatchString(value) {
+				return "", fmt.Errorf("csv value %q is not a number, use ${name:sqlstring} for strings", value)
+			}
+		}
+		return strings.Join(values, ","), nil
+	case VariableFormatRegex:
+		return "'" + quoteString(regexValue(values)) + "'", nil
+	default:
+		quoted := make([]string, len(values))
+		for i, value := range values {
+			quoted[i] = "'" + quoteString(value) + "'"
+		}
+		return strings.Join(quoted, ","), nil
+	}
+}
+
+// regexValue matches any of the values literally
+func regexValue(values []string) string {
+	escaped := make([]string, len(values))
+	for i, value := range values {
+		escaped[i] = regexp.QuoteMeta(value)
+	}
+	if len(escaped) == 1 {
+		return escaped[0]
+	}
+	return "(" + strings.Join(escaped, "|") + ")"
+}
+
+// quoteString escapes a value for the inside of a quoted sql string
+func quoteString(value string) string {
+	return strings.ReplaceAll(value, "'", "''")
+}
+
+// sqlContext is the part of a query a position is in
+type sqlContext int
+
+const (
+	sqlContextCode sqlContext = iota
+	sqlContextString
+	sqlContextIdentifier
+	sqlContextComment
+)
+
+// sqlContexts returns the context of every byte of sql, quotes are escaped by doubling them
+func sqlContexts(sql string) []sqlContext {
+	contexts := make([]sqlContext, len(sql))
+	context := sqlContextCode
+	blockComment := false
+	for i := 0; i < len(sql); i++ {
+		switch context {
+		case sqlContextCode:
+			switch {
+			case sql[i] == '\'':
+				context = sqlContextString
+			case sql[i] == '"':
+				context = sqlContextIdentifier
+			case strings.HasPrefix(sql[i:], "--"):
+				context, blockComment = sqlContextComment, false
+			case strings.HasPrefix(sql[i:], "/*"):
+				context, blockComment = sqlContextComment, true
+			}
+			contexts[i] = context
+		case sqlContextString, sqlContextIdentifier:
+			contexts[i] = context
+			quote := byte('\'')
+			if context == sqlContextIdentifier {
+				quote = '"'
+			}
+			if sql[i] == quote {
+				if i+1 < len(sql) && sql[i+1] == quote {
+					contexts[i+1] = context
+					i++
+				} else {
+					context = sqlContextCode
+				}
+			}
+		case sqlContextComment:
+			contexts[i] = context
+			if !blockComment && sql[i] == '\n' {
+				context = sqlContextCode
+			} else if blockComment && strings.HasPrefix(sql[i:], "*/") {
+				contexts[i+1] = context
+				i++
+				context = sqlContextCode
+			}
+		}
+	}
+	return contexts
+}
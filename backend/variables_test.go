@@ -0,0 +1,98 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestInterpolateVariables(t *testing.T) {
+	variables := map[string][]string{
+		"host":   {"web-1"},
+		"hosts":  {"web-1", "web-2"},
+		"inject": {" OR 1=1 --"},
+		"quote":  {"it's"},
+		"ids":    {"1", "2.5"},
+		"union":  {"1) UNION SELECT secret FROM users --"},
+		"regex":  {"a.b", "c'd"},
+		"col":    {`cpu"; DROP TABLE t --`},
+		"table":  {"logs WHERE 1=1"},
+		"empty":  {},
+	}
+	tests := []struct {
+		name string
+		sql  string
+		want string
+		err  string
+	}{
+		{"default quotes", "WHERE host = $host", "WHERE host = 'web-1'", ""},
+		{"default multi value", "WHERE host IN ($hosts)", "WHERE host IN ('web-1','web-2')", ""},
+		{"default doubles quotes", "WHERE host = $quote", "WHERE host = 'it''s'", ""},
+		{"default in quoted string", "WHERE host = '$host'", "WHERE host = 'web-1'", ""},
+		{"default in quoted string cannot end it", "WHERE host = '$inject'", "WHERE host = ' OR 1=1 --'", ""},
+		{"default in quoted string doubles quotes", "WHERE host = '$quote'", "WHERE host = 'it''s'", ""},
+		{"default multi value in quoted string", "WHERE host = '$hosts'", "", "2 values in a quoted string"},
+		{"sqlstring", "WHERE host IN (${hosts:sqlstring})", "WHERE host IN ('web-1','web-2')", ""},
+		{"sqlstring in quoted string", "WHERE host = '${inject:sqlstring}'", "WHERE host = ' OR 1=1 --'", ""},
+		{"braces", "WHERE host = ${host}", "WHERE host = 'web-1'", ""},
+		{"brackets", "WHERE host = [[host]]", "WHERE host = 'web-1'", ""},
+		{"csv numbers", "WHERE id IN (${ids:csv})", "WHERE id IN (1,2.5)", ""},
+		{"csv rejects non numbers", "WHERE id IN (${union:csv})", "", "is not a number"},
+		{"csv in quoted string", "WHERE host = '${hosts:csv}'", "WHERE host = 'web-1,web-2'", ""},
+		{"csv in quoted string doubles quotes", "WHERE host = '${quote:csv}'", "WHERE host = 'it''s'", ""},
+		{"regex quoted", "WHERE regexp_like(host, ${regex:regex})", `WHERE regexp_like(host, '(a\.b|c''d)')`, ""},
+		{"regex in quoted string", "WHERE regexp_like(host, '^${regex:regex}$')", `WHERE regexp_like(host, '^(a\.b|c''d)$')`, ""},
+		{"raw is unescaped", "SELECT * FROM ${table:raw}", "SELECT * FROM logs WHERE 1=1", ""},
+		{"raw in quoted string is unescaped", "WHERE host = '${quote:raw}'", "WHERE host = 'it's'", ""},
+		{"quoted identifier", `SELECT "$col" FROM t`, `SELECT "cpu""; DROP TABLE t --" FROM t`, ""},
+		{"quoted identifier multi value", `SELECT "$hosts" FROM t`, "", "2 values in a quoted identifier"},
+		{"escaped quote keeps string", "WHERE a = 'it''s $host'", "WHERE a = 'it''s web-1'", ""},
+		{"string ends before reference", "WHERE a = 'x' AND host = $host", "WHERE a = 'x' AND host = 'web-1'", ""},
+		{"line comment kept", "SELECT 1 -- $inject\nWHERE host = $host", "SELECT 1 -- $inject\nWHERE host = 'web-1'", ""},
+		{"block comment kept", "SELECT /* it's $host */ $host", "SELECT /* it's $host */ 'web-1'", ""},
+		{"unknown variable kept", "WHERE host = $other", "WHERE host = $other", ""},
+		{"macros kept", "WHERE $__timeFilter(time)", "WHERE $__timeFilter(time)", ""},
+		{"no values", "WHERE host IN ($empty)", "", "no values"},
+		{"no values csv", "WHERE id IN (${empty:csv})", "", "no values"},
+		{"no values in quoted string", "WHERE host = '${empty:csv}'", "WHERE host = ''", ""},
+		{"unknown format", "WHERE host = ${host:json}", "", "unknown format json"},
+		{"nul rejected", "WHERE host = $nul", "", "invalid character"},
+	}
+	variables["nul"] = []string{"a\x00b"}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := interpolateVariables(tt.sql, variables)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("interpolateVariables(%q) error = %v, want %q", tt.sql, err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("interpolateVariables(%q) error = %v", tt.sql, err)
+			}
+			if got != tt.want {
+				t.Errorf("interpolateVariables(%q) = %q, want %q", tt.sql, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSqlContexts(t *testing.T) {
+	sql := `a 'b''c' "d" -- e` + "\n" + `f /* g */ h`
+	want := map[byte]sqlContext{
+		'a': sqlContextCode,
+		'b': sqlContextString,
+		'c': sqlContextString,
+		'd': sqlContextIdentifier,
+		'e': sqlContextComment,
+		'f': sqlContextCode,
+		'g': sqlContextComment,
+		'h': sqlContextCode,
+	}
+	contexts := sqlContexts(sql)
+	for i := 0; i < len(sql); i++ {
+		if context, ok := want[sql[i]]; ok && contexts[i] != context {
+			t.Errorf("context of %q = %d, want %d", sql[i], contexts[i], context)
+		}
+	}
+}
@@ -1,10 +1,13 @@
 module github.com/pway123/aws-athena-grafana-datasource
 
-go 1.14
+go 1.15
 
 require (
-	github.com/aws/aws-sdk-go-v2 v0.20.0
-	github.com/grafana/grafana-plugin-model v0.0.0-20190930120109-1fc953a61fb4
-	github.com/hashicorp/go-hclog v0.12.2
-	github.com/hashicorp/go-plugin v1.2.0
+	github.com/aws/aws-sdk-go-v2 v1.17.1
+	github.com/aws/aws-sdk-go-v2/config v1.18.0
+	github.com/aws/aws-sdk-go-v2/credentials v1.13.0
+	github.com/aws/aws-sdk-go-v2/service/athena v1.20.0
+	github.com/aws/aws-sdk-go-v2/service/s3 v1.29.1
+	github.com/aws/aws-sdk-go-v2/service/sts v1.17.2
+	github.com/grafana/grafana-plugin-sdk-go v0.114.0
 )
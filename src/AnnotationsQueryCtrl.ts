@@ -0,0 +1,12 @@
+import { AthenaDsQuery, defaultAnnotationQuery } from './types';
+import defaults from 'lodash/defaults';
+
+export class AthenaAnnotationsQueryCtrl {
+  static templateUrl = 'partials/annotations.editor.html';
+
+  annotation: any;
+
+  constructor() {
+    this.annotation.target = defaults(this.annotation.target as AthenaDsQuery, defaultAnnotationQuery);
+  }
+}
@@ -9,6 +9,8 @@ interface State {
   selectedAuthType: SelectableValue;
 }
 
+const BYTES_PER_GB = 1000 * 1000 * 1000;
+
 const authTypes = [
   { label: 'Static', value: AuthType.Static },
   { label: 'Role ARN', value: AuthType.RoleArn },
@@ -58,6 +60,52 @@ export class ConfigEditor extends PureComponent<Props, State> {
     onOptionsChange({ ...options, jsonData });
   };
 
+  onQueryTimeoutChange = (event: ChangeEvent<HTMLInputElement>) => {
+    const { onOptionsChange, options } = this.props;
+    const jsonData = {
+      ...options.jsonData,
+      queryTimeout: parseInt(event.target.value, 10) || undefined,
+    };
+    onOptionsChange({ ...options, jsonData });
+  };
+
+  onDefaultCatalogChange = (event: ChangeEvent<HTMLInputElement>) => {
+    const { onOptionsChange, options } = this.props;
+    const jsonData = {
+      ...options.jsonData,
+      defaultCatalog: event.target.value,
+    };
+    onOptionsChange({ ...options, jsonData });
+  };
+
+  onDefaultDatabaseChange = (event: ChangeEvent<HTMLInputElement>) => {
+    const { onOptionsChange, options } = this.props;
+    const jsonData = {
+      ...options.jsonData,
+      defaultDatabase: event.target.value,
+    };
+    onOptionsChange({ ...options, jsonData });
+  };
+
+  onMaxScannedChange = (event: ChangeEvent<HTMLInputElement>) => {
+    const { onOptionsChange, options } = this.props;
+    const gigabytes = parseFloat(event.target.value);
+    const jsonData = {
+      ...options.jsonData,
+      maxBytesScanned: gigabytes > 0 ? Math.round(gigabytes * BYTES_PER_GB) : undefined,
+    };
+    onOptionsChange({ ...options, jsonData });
+  };
+
+  onPricePerTBChange = (event: ChangeEvent<HTMLInputElement>) => {
+    const { onOptionsChange, options } = this.props;
+    const jsonData = {
+      ...options.jsonData,
+      pricePerTB: parseFloat(event.target.value) || undefined,
+    };
+    onOptionsChange({ ...options, jsonData });
+  };
+
   // Secure field (only sent to the backend)
   onSecretAccessKeyChange = (event: ChangeEvent<HTMLInputElement>) => {
     const { onOptionsChange, options } = this.props;
@@ -129,6 +177,64 @@ export class ConfigEditor extends PureComponent<Props, State> {
             placeholder="primary"
           />
         </div>
+        <div className="gf-form">
+          <FormField
+            label="Timeout"
+            labelWidth={6}
+            inputWidth={20}
+            type="number"
+            onChange={this.onQueryTimeoutChange}
+            value={jsonData.queryTimeout || ''}
+            placeholder="60"
+            tooltip="Seconds to wait for a query execution. Keep it below the alert evaluation timeout when alerting on this datasource"
+          />
+        </div>
+        <div className="gf-form">
+          <FormField
+            label="Catalog"
+            labelWidth={6}
+            inputWidth={20}
+            onChange={this.onDefaultCatalogChange}
+            value={jsonData.defaultCatalog || ''}
+            placeholder="AwsDataCatalog"
+            tooltip="Default data catalog of queries, queries may select another one"
+          />
+        </div>
+        <div className="gf-form">
+          <FormField
+            label="Database"
+            labelWidth={6}
+            inputWidth={20}
+            onChange={this.onDefaultDatabaseChange}
+            value={jsonData.defaultDatabase || ''}
+            placeholder="default"
+            tooltip="Default database of queries, queries may select another one"
+          />
+        </div>
+        <div className="gf-form">
+          <FormField
+            label="Max Scan (GB)"
+            labelWidth={6}
+            inputWidth={20}
+            type="number"
+            onChange={this.onMaxScannedChange}
+            value={jsonData.maxBytesScanned ? jsonData.maxBytesScanned / BYTES_PER_GB : ''}
+            placeholder="no limit"
+            tooltip="Queries scanning more data are stopped"
+          />
+        </div>
+        <div className="gf-form">
+          <FormField
+            label="Price per TB"
+            labelWidth={6}
+            inputWidth={20}
+            type="number"
+            onChange={this.onPricePerTBChange}
+            value={jsonData.pricePerTB || ''}
+            placeholder="5"
+            tooltip="Dollars per TB scanned, used to estimate the cost of queries"
+          />
+        </div>
         {this.state.selectedAuthType.value === AuthType.Static && (
           <div className="gf-form">
             <FormField
@@ -1,183 +1,199 @@
 import defaults from 'lodash/defaults';
 
 import _ from 'lodash';
-import { getBackendSrv, BackendSrv } from '@grafana/runtime';
+import { getBackendSrv, getTemplateSrv, BackendSrv, DataSourceWithBackend, toDataQueryResponse } from '@grafana/runtime';
 import {
-  DataQueryRequest,
-  DataQueryResponse,
-  DataSourceApi,
+  AnnotationEvent,
+  AnnotationQueryRequest,
+  DataFrame,
+  DataFrameView,
   DataSourceInstanceSettings,
-  MutableDataFrame,
-  MutableField,
-  FieldType,
+  ScopedVars,
 } from '@grafana/data';
 
-import { AthenaDsQuery, AthenaDsOptions, defaultQuery, CustomMetadata, RowValueType, QueryType, FormatType } from './types';
+import {
+  AthenaDsQuery,
+  AthenaDsOptions,
+  defaultQuery,
+  defaultAnnotationQuery,
+  defaultVariableQuery,
+  QueryType,
+  FormatType,
+  TableColumn,
+  AdhocFilter,
+} from './types';
 
-const BACKEND_URL = '/api/tsdb/query';
+const BACKEND_URL = '/api/ds/query';
 
-export class AthenaDataSource extends DataSourceApi<AthenaDsQuery, AthenaDsOptions> {
+export class AthenaDataSource extends DataSourceWithBackend<AthenaDsQuery, AthenaDsOptions> {
   private backendSrv: BackendSrv;
   private headers: any;
+  defaultCatalog?: string;
+  defaultDatabase?: string;
 
   constructor(instanceSettings: DataSourceInstanceSettings<AthenaDsOptions>) {
     super(instanceSettings);
+    this.defaultCatalog = instanceSettings.jsonData.defaultCatalog;
+    this.defaultDatabase = instanceSettings.jsonData.defaultDatabase;
     this.backendSrv = getBackendSrv();
     this.headers = {
       'Content-Type': 'application/json',
     };
   }
 
-  async query(options: DataQueryRequest<AthenaDsQuery>): Promise<DataQueryResponse> {
-    const { range, targets } = options;
-    const from = range!.from.valueOf().toString();
-    const to = range!.to.valueOf().toString();
+  filterQuery(query: AthenaDsQuery): boolean {
+    // TODO more validation
+    return query.hide !== true;
+  }
 
-    const queries = targets.filter(this.isValidQuery);
-    const request = {
-      url: BACKEND_URL,
-      method: 'POST',
-      headers: this.headers,
-      data: {
-        from,
-        to,
-        queries: queries.map(target => {
-          const t = defaults(target, defaultQuery);
-          return {
-            datasourceId: this.id,
-            ...t,
-          };
-        }),
-      },
+  applyTemplateVariables(query: AthenaDsQuery, scopedVars?: ScopedVars): AthenaDsQuery {
+    return {
+      ...defaults(query, defaultQuery),
+      variables: this.getVariableValues(scopedVars),
+      adhocFilters: this.getAdhocFilters(),
     };
-    return this.backendSrv
-      .datasourceRequest(request)
-      .then((res: any) => {
-        const data: any[] = [];
-        for (const query of queries) {
-          const result = res.data.results[query.refId];
-          if (!_.isEmpty(result.series)) {
-            // time series
-            _.forEach(result.series, serie => {
-              data.push({ target: serie.name, datapoints: serie.points });
-            });
-          }
-          if (!_.isEmpty(result.tables)) {
-            // table
-            const meta: CustomMetadata = result.meta;
-            _.forEach(result.tables, table => {
-              const tableData = new MutableDataFrame({
-                refId: query.refId,
-                fields: table.columns?.map(
-                  (col: any, colIndex: number): MutableField => {
-                    return {
-                      name: col.text,
-                      values: table.rows.map((row: any[]) => row[colIndex]),
-                      type: determineFieldType(col.text, meta.colInfos.find(info => info.colName === col.text)?.colType, query.timeColumn),
-                      config: {},
-                    };
-                  }
-                ),
-              });
-              data.push(tableData);
-            });
-          }
-        }
-        res.data = data;
-        return res;
-      })
-      .catch((err: any = { data: { error: '' } }) => {
-        console.log('Err: ', err);
-        if (err.data && err.data.message === 'Metric request error' && err.data.error) {
-          err.data.message = err.data.error;
-        }
+  }
 
-        throw err;
-      });
+  // ad-hoc filters of the dashboard for this datasource, the backend turns them into a where condition
+  getAdhocFilters(): AdhocFilter[] {
+    const templateSrv = getTemplateSrv() as any;
+    if (!templateSrv.getAdhocFilters) {
+      return [];
+    }
+    return (templateSrv.getAdhocFilters(this.name) || []).map((filter: any) => ({
+      key: filter.key,
+      operator: filter.operator,
+      value: String(filter.value),
+    }));
   }
 
-  async testDatasource() {
-    // call backend with queryType '' for healthcheck
-    try {
-      const res = await this.backendSrv.datasourceRequest({
-        url: BACKEND_URL,
-        method: 'POST',
-        headers: this.headers,
-        data: {
-          queries: [
-            {
-              datasourceId: this.id,
-              ...defaultQuery,
-            },
-          ],
-        },
+  // values of the template variables, the backend interpolates them into the sql with escaping
+  getVariableValues(scopedVars?: ScopedVars): { [name: string]: string[] } {
+    const templateSrv = getTemplateSrv();
+    const variables: { [name: string]: string[] } = {};
+    for (const variable of templateSrv.getVariables()) {
+      templateSrv.replace(`\${${variable.name}}`, scopedVars, (value: string | string[]) => {
+        variables[variable.name] = _.castArray(value).map(v => String(v));
+        return '';
       });
-      const isSuccess = res.status === 200;
-      return {
-        status: isSuccess ? 'success' : 'failed',
-        message: isSuccess ? 'Success' : 'Failed',
-      };
-    } catch {
-      return {
-        status: 'error',
-        message: 'Error',
-      };
     }
+    return variables;
+  }
+
+  async annotationQuery(options: AnnotationQueryRequest<AthenaDsQuery>): Promise<AnnotationEvent[]> {
+    const { annotation, range } = options;
+    const target = defaults({ ...annotation.target }, defaultAnnotationQuery);
+    const frames = await this.doBackendRequest(
+      {
+        ...target,
+        refId: 'annotationQuery',
+        format: FormatType.Annotations,
+      },
+      range.from.valueOf().toString(),
+      range.to.valueOf().toString()
+    );
+    return _.flatMap(frames, frame =>
+      new DataFrameView(frame).map(
+        (row: any): AnnotationEvent => ({
+          annotation,
+          time: row.time,
+          timeEnd: row.timeEnd !== row.time ? row.timeEnd : undefined,
+          isRegion: row.timeEnd !== row.time,
+          title: row.title,
+          text: row.text,
+          tags: row.tags ? row.tags.split(',') : [],
+        })
+      )
+    );
+  }
+
+  async metricFindQuery(query: AthenaDsQuery | string, options?: any) {
+    // queries saved by the default variable editor are raw sql
+    const target = typeof query === 'string' ? { queryString: query, queryType: QueryType.RawQuery } : query;
+    const range = options && options.range;
+    const frames = await this.doBackendRequest(
+      {
+        ...defaults({ ...target }, defaultVariableQuery),
+        refId: 'variableQuery',
+        format: FormatType.Variable,
+      },
+      range ? range.from.valueOf().toString() : undefined,
+      range ? range.to.valueOf().toString() : undefined
+    );
+    return this.transformSuggestDataFromFrames(frames);
   }
 
   async getNamedQueries() {
     return await this.doMetricQueryRequest(QueryType.GetNamedQueryMetrics);
   }
 
-  private isValidQuery(q: AthenaDsQuery): boolean {
-    // TODO more validation
-    return q.hide !== true;
+  async getCatalogs(): Promise<string[]> {
+    return await this.getResource('catalogs');
   }
 
-  private transformSuggestDataFromTable(suggestData: any) {
-    return _.map(suggestData.results['metricFindQuery'].tables[0].rows, v => {
-      return {
-        text: v[0],
-        value: v[1],
-        label: v[1],
-      };
-    });
+  async getDatabases(catalog?: string): Promise<string[]> {
+    return await this.getResource('databases', { catalog });
+  }
+
+  async getTables(database: string, catalog?: string): Promise<string[]> {
+    return await this.getResource('tables', { catalog, database });
+  }
+
+  async getColumns(database: string, table: string, catalog?: string): Promise<TableColumn[]> {
+    return await this.getResource('columns', { catalog, database, table });
+  }
+
+  async getPreparedStatements(): Promise<string[]> {
+    return await this.getResource('prepared-statements');
+  }
+
+  private transformSuggestDataFromFrames(frames: DataFrame[]) {
+    return _.flatMap(frames, frame =>
+      new DataFrameView(frame).map((row: any) => {
+        return {
+          text: row.text,
+          value: row.value,
+          label: row.value,
+        };
+      })
+    );
   }
 
   private async doMetricQueryRequest(queryType: string, params?: Partial<AthenaDsQuery>) {
+    const frames = await this.doBackendRequest(
+      _.extend(
+        {
+          refId: 'metricFindQuery',
+          queryType,
+          format: FormatType.Table,
+        },
+        params
+      )
+    );
+    return this.transformSuggestDataFromFrames(frames);
+  }
+
+  private async doBackendRequest(query: AthenaDsQuery, from?: string, to?: string): Promise<DataFrame[]> {
     const res = await this.backendSrv.datasourceRequest({
       url: BACKEND_URL,
       method: 'POST',
       headers: this.headers,
       data: {
+        from,
+        to,
         queries: [
-          _.extend(
-            {
-              refId: 'metricFindQuery',
-              datasourceId: this.id,
-              queryType,
-              format: FormatType.Table,
-            },
-            params
-          ),
+          {
+            variables: this.getVariableValues(),
+            ...query,
+            datasourceId: this.id,
+          },
         ],
       },
     });
-    return this.transformSuggestDataFromTable(res.data);
-  }
-}
-
-function determineFieldType(fieldName: string, rowValueType?: RowValueType, timeColumn?: string): FieldType {
-  if (fieldName === timeColumn) {
-    return FieldType.time;
-  }
-  switch (rowValueType) {
-    case RowValueType.BOOL:
-      return FieldType.boolean;
-    case RowValueType.INT:
-    case RowValueType.DOUBLE:
-      return FieldType.number;
-    default:
-      return FieldType.string;
+    const response = toDataQueryResponse(res);
+    if (response.error) {
+      throw response.error;
+    }
+    return response.data as DataFrame[];
   }
 }
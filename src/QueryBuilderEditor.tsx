@@ -0,0 +1,276 @@
+import React, { PureComponent, ChangeEvent } from 'react';
+import { FormField, Button, Select, FormLabel, Input } from '@grafana/ui';
+import { SelectableValue } from '@grafana/data';
+import { AthenaDataSource } from './DataSource';
+import { QueryBuilder, BuilderColumn, BuilderFilter, BuilderOrder, ParameterType } from './types';
+
+interface Props {
+  datasource: AthenaDataSource;
+  catalog?: string;
+  database?: string;
+  builder: QueryBuilder;
+  onChange: (builder: QueryBuilder) => void;
+}
+
+interface QueryBuilderEditorState {
+  tables: SelectableValue[];
+  columns: SelectableValue[];
+}
+
+const aggregations = [
+  { label: 'None', value: '' },
+  { label: 'Sum', value: 'sum' },
+  { label: 'Avg', value: 'avg' },
+  { label: 'Min', value: 'min' },
+  { label: 'Max', value: 'max' },
+  { label: 'Count', value: 'count' },
+  { label: 'Count Distinct', value: 'count_distinct' },
+  { label: 'Approx Distinct', value: 'approx_distinct' },
+];
+
+const operators = ['=', '!=', '<', '<=', '>', '>=', 'LIKE', 'NOT LIKE', 'IN', 'NOT IN', 'IS NULL', 'IS NOT NULL'].map(op => ({
+  label: op,
+  value: op,
+}));
+
+const valueTypes = [
+  { label: 'String', value: ParameterType.String },
+  { label: 'Number', value: ParameterType.Number },
+  { label: 'Boolean', value: ParameterType.Boolean },
+  { label: 'Timestamp', value: ParameterType.Timestamp },
+  { label: 'Date', value: ParameterType.Date },
+];
+
+const FIELD_WIDTH = 15;
+
+// value of a select allowing custom values, values missing from the options are shown as typed
+const toOption = (value?: string): SelectableValue | undefined => (value ? { label: value, value } : undefined);
+
+export class QueryBuilderEditor extends PureComponent<Props, QueryBuilderEditorState> {
+  state: QueryBuilderEditorState = {
+    tables: [],
+    columns: [],
+  };
+
+  componentDidMount() {
+    this.loadTables();
+    this.loadColumns();
+  }
+
+  componentDidUpdate(prevProps: Props) {
+    if (prevProps.catalog !== this.props.catalog || prevProps.database !== this.props.database) {
+      this.loadTables();
+      this.loadColumns();
+    } else if (prevProps.builder.table !== this.props.builder.table) {
+      this.loadColumns();
+    }
+  }
+
+  async loadTables() {
+    const { datasource, catalog, database } = this.props;
+    const tables = await datasource.getTables(database || '', catalog);
+    this.setState({
+      tables: tables.map(name => ({ label: name, value: name })),
+    });
+  }
+
+  async loadColumns() {
+    const { datasource, catalog, builder } = this.props;
+    if (!builder.table) {
+      this.setState({ columns: [] });
+      return;
+    }
+    // a table may be qualified with its database as database.table
+    const parts = builder.table.split('.');
+    const table = parts.pop() as string;
+    const database = parts.length > 0 ? parts.join('.') : this.props.database || '';
+    const columns = await datasource.getColumns(database, table, catalog);
+    this.setState({
+      columns: columns.map(column => ({ label: column.name, value: column.name, description: column.type })),
+    });
+  }
+
+  onFieldChange = (fieldName: keyof QueryBuilder, isNumeric = false) => {
+    return (event: ChangeEvent<HTMLInputElement>) => {
+      const value = isNumeric ? parseInt(event.target.value, 10) || 0 : event.target.value;
+      this.props.onChange({ ...this.props.builder, [fieldName]: value });
+    };
+  };
+
+  onColumnsChange = (columns: BuilderColumn[]) => {
+    this.props.onChange({ ...this.props.builder, columns });
+  };
+
+  onFiltersChange = (filters: BuilderFilter[]) => {
+    this.props.onChange({ ...this.props.builder, filters });
+  };
+
+  onOrderByChange = (orderBy: BuilderOrder[]) => {
+    this.props.onChange({ ...this.props.builder, orderBy });
+  };
+
+  render() {
+    const { builder } = this.props;
+    const columns = builder.columns || [];
+    const filters = builder.filters || [];
+    const orderBy = builder.orderBy || [];
+    const { tables, columns: columnOptions } = this.state;
+
+    return (
+      <>
+        <div className="gf-form-inline">
+          <FormLabel width={FIELD_WIDTH}>Table</FormLabel>
+          <Select
+            width={FIELD_WIDTH}
+            options={tables}
+            value={toOption(builder.table)}
+            allowCustomValue
+            placeholder="database.table"
+            onChange={v => this.props.onChange({ ...builder, table: v.value || '' })}
+          />
+          <FormLabel width={FIELD_WIDTH} tooltip="Timestamp column filtered by the time range and grouped into intervals">
+            Time Column
+          </FormLabel>
+          <Select
+            width={FIELD_WIDTH}
+            options={columnOptions}
+            value={toOption(builder.timeColumn)}
+            allowCustomValue
+            isClearable
+            onChange={v => this.props.onChange({ ...builder, timeColumn: (v && v.value) || '' })}
+          />
+          <FormField
+            labelWidth={FIELD_WIDTH}
+            value={builder.interval || ''}
+            onChange={this.onFieldChange('interval')}
+            label="Interval"
+            placeholder="auto"
+          ></FormField>
+        </div>
+        <div className="gf-form">
+          <FormField
+            labelWidth={FIELD_WIDTH}
+            value={builder.partitionColumns || ''}
+            onChange={this.onFieldChange('partitionColumns')}
+            label="Partitions"
+            placeholder="year, month, day"
+            tooltip="Partition columns pruned by the time range, as arguments of $__partitionFilter, e.g. dt:yyyy-MM-dd"
+          ></FormField>
+        </div>
+        {columns.map((column, i) => (
+          <div className="gf-form-inline" key={`column${i}`}>
+            <FormLabel width={FIELD_WIDTH}>Select</FormLabel>
+            <Select
+              width={FIELD_WIDTH}
+              options={aggregations}
+              value={aggregations.find(a => a.value === (column.aggregation || ''))}
+              onChange={v => this.onColumnsChange(columns.map((c, j) => (i === j ? { ...c, aggregation: v.value } : c)))}
+            />
+            <Select
+              width={FIELD_WIDTH}
+              options={[{ label: '*', value: '*' }, ...columnOptions]}
+              value={toOption(column.column)}
+              allowCustomValue
+              placeholder="column"
+              onChange={v => this.onColumnsChange(columns.map((c, j) => (i === j ? { ...c, column: v.value || '' } : c)))}
+            />
+            <Input
+              width={FIELD_WIDTH}
+              value={column.alias || ''}
+              placeholder="alias"
+              onChange={e => this.onColumnsChange(columns.map((c, j) => (i === j ? { ...c, alias: e.currentTarget.value } : c)))}
+            />
+            <Button variant="secondary" onClick={() => this.onColumnsChange(columns.filter((c, j) => i !== j))}>
+              Remove
+            </Button>
+          </div>
+        ))}
+        <div className="gf-form">
+          <FormField
+            labelWidth={FIELD_WIDTH}
+            value={(builder.groupBy || []).join(', ')}
+            onChange={e => this.props.onChange({ ...builder, groupBy: e.target.value.split(',').map(c => c.trim()).filter(c => c) })}
+            label="Group By"
+            placeholder="host, region"
+          ></FormField>
+        </div>
+        {filters.map((filter, i) => (
+          <div className="gf-form-inline" key={`filter${i}`}>
+            <FormLabel width={FIELD_WIDTH}>Where</FormLabel>
+            <Select
+              width={FIELD_WIDTH}
+              options={columnOptions}
+              value={toOption(filter.column)}
+              allowCustomValue
+              placeholder="column"
+              onChange={v => this.onFiltersChange(filters.map((f, j) => (i === j ? { ...f, column: v.value || '' } : f)))}
+            />
+            <Select
+              width={FIELD_WIDTH}
+              options={operators}
+              value={operators.find(o => o.value === filter.operator)}
+              onChange={v => this.onFiltersChange(filters.map((f, j) => (i === j ? { ...f, operator: v.value } : f)))}
+            />
+            <Input
+              width={FIELD_WIDTH}
+              value={filter.value}
+              placeholder="value or $variable"
+              onChange={e => this.onFiltersChange(filters.map((f, j) => (i === j ? { ...f, value: e.currentTarget.value } : f)))}
+            />
+            <Select
+              width={FIELD_WIDTH}
+              options={valueTypes}
+              value={valueTypes.find(t => t.value === (filter.type || ParameterType.String))}
+              onChange={v => this.onFiltersChange(filters.map((f, j) => (i === j ? { ...f, type: v.value } : f)))}
+            />
+            <Button variant="secondary" onClick={() => this.onFiltersChange(filters.filter((f, j) => i !== j))}>
+              Remove
+            </Button>
+          </div>
+        ))}
+        {orderBy.map((order, i) => (
+          <div className="gf-form-inline" key={`order${i}`}>
+            <FormLabel width={FIELD_WIDTH}>Order By</FormLabel>
+            <Select
+              width={FIELD_WIDTH}
+              options={columnOptions}
+              value={toOption(order.column)}
+              allowCustomValue
+              placeholder="column or alias"
+              onChange={v => this.onOrderByChange(orderBy.map((o, j) => (i === j ? { ...o, column: v.value || '' } : o)))}
+            />
+            <FormLabel width={6}>Desc</FormLabel>
+            <Input
+              type="checkbox"
+              checked={order.desc}
+              onChange={e => this.onOrderByChange(orderBy.map((o, j) => (i === j ? { ...o, desc: e.currentTarget.checked } : o)))}
+            />
+            <Button variant="secondary" onClick={() => this.onOrderByChange(orderBy.filter((o, j) => i !== j))}>
+              Remove
+            </Button>
+          </div>
+        ))}
+        <div className="gf-form">
+          <FormField
+            labelWidth={FIELD_WIDTH}
+            type="number"
+            value={builder.limit || ''}
+            onChange={this.onFieldChange('limit', true)}
+            label="Limit"
+          ></FormField>
+        </div>
+        <div className="gf-form">
+          <Button variant="secondary" onClick={() => this.onColumnsChange([...columns, { column: '', aggregation: '', alias: '' }])}>
+            Add Column
+          </Button>
+          <Button variant="secondary" onClick={() => this.onFiltersChange([...filters, { column: '', operator: '=', value: '', type: ParameterType.String }])}>
+            Add Filter
+          </Button>
+          <Button variant="secondary" onClick={() => this.onOrderByChange([...orderBy, { column: '', desc: false }])}>
+            Add Order
+          </Button>
+        </div>
+      </>
+    );
+  }
+}
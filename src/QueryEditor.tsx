@@ -4,24 +4,86 @@ import React, { PureComponent, ChangeEvent } from 'react';
 import { FormField, Button, Select, FormLabel, Input } from '@grafana/ui';
 import { QueryEditorProps, SelectableValue } from '@grafana/data';
 import { AthenaDataSource } from './DataSource';
-import { AthenaDsQuery, AthenaDsOptions, defaultQuery, QueryType, FormatType } from './types';
+import {
+  AthenaDsQuery,
+  AthenaDsOptions,
+  defaultQuery,
+  QueryType,
+  FormatType,
+  AggregationType,
+  FillMode,
+  DownsampleType,
+  SortType,
+  ParameterType,
+  QueryParameter,
+} from './types';
 import { getDataSourceSrv } from '@grafana/runtime';
+import { QueryBuilderEditor } from './QueryBuilderEditor';
 
 type Props = QueryEditorProps<AthenaDataSource, AthenaDsQuery, AthenaDsOptions>;
 
 const queryTypes = [
-  { label: 'Select', value: QueryType.TestQuery },
+  { label: 'Select', value: QueryType.None },
   { label: 'Exec Named Query', value: QueryType.NamedQuery },
   { label: 'Fetch Exec Results', value: QueryType.ExecutionQuery },
+  { label: 'Raw Query', value: QueryType.RawQuery },
+  { label: 'Prepared Statement', value: QueryType.PreparedStatement },
+  { label: 'Query Builder', value: QueryType.Builder },
 ];
 
 const formatTypes = [
   { label: 'Time Series', value: FormatType.TimeSeries },
   { label: 'Table', value: FormatType.Table },
+  { label: 'Logs', value: FormatType.Logs },
+  { label: 'Heatmap', value: FormatType.Heatmap },
+];
+
+const aggregationTypes = [
+  { label: 'None', value: AggregationType.None },
+  { label: 'Sum', value: AggregationType.Sum },
+  { label: 'Avg', value: AggregationType.Avg },
+  { label: 'Min', value: AggregationType.Min },
+  { label: 'Max', value: AggregationType.Max },
+  { label: 'Last', value: AggregationType.Last },
+  { label: 'Count', value: AggregationType.Count },
+];
+
+const fillModes = [
+  { label: 'None', value: FillMode.None },
+  { label: 'Null', value: FillMode.Null },
+  { label: 'Zero', value: FillMode.Zero },
+  { label: 'Previous', value: FillMode.Previous },
+  { label: 'Linear', value: FillMode.Linear },
+];
+
+const downsampleTypes = [
+  { label: 'None', value: DownsampleType.None },
+  { label: 'Avg', value: DownsampleType.Avg },
+  { label: 'Min', value: DownsampleType.Min },
+  { label: 'Max', value: DownsampleType.Max },
+  { label: 'LTTB', value: DownsampleType.LTTB },
+];
+
+const sortTypes = [
+  { label: 'Name', value: SortType.Name },
+  { label: 'Total', value: SortType.Total },
+  { label: 'Max', value: SortType.Max },
+  { label: 'Last', value: SortType.Last },
+];
+
+const parameterTypes = [
+  { label: 'String', value: ParameterType.String },
+  { label: 'Number', value: ParameterType.Number },
+  { label: 'Boolean', value: ParameterType.Boolean },
+  { label: 'Timestamp', value: ParameterType.Timestamp },
+  { label: 'Date', value: ParameterType.Date },
 ];
 
 interface QueryEditorState {
   namedQueries: SelectableValue[];
+  preparedStatements: SelectableValue[];
+  catalogs: SelectableValue[];
+  databases: SelectableValue[];
   selectedQueryType: SelectableValue;
   selectedNameQuery: SelectableValue;
   selectedFormatType: SelectableValue;
@@ -35,6 +97,9 @@ export class QueryEditor extends PureComponent<Props, QueryEditorState> {
     this.state = {
       selectedQueryType: queryTypes.find(q => q.value === props.query.queryType) || queryTypes[0],
       namedQueries: [],
+      preparedStatements: [],
+      catalogs: [],
+      databases: [],
       selectedNameQuery: { label: '', value: '' } as SelectableValue,
       selectedFormatType: formatTypes.find(f => f.value === props.query.format) || formatTypes[0],
     };
@@ -42,6 +107,30 @@ export class QueryEditor extends PureComponent<Props, QueryEditorState> {
 
   componentDidMount() {
     this.loadNamedQueries();
+    this.loadPreparedStatements();
+    this.loadCatalogs();
+    this.loadDatabases(this.props.query.catalog);
+  }
+
+  async loadCatalogs() {
+    const catalogs = await this.props.datasource.getCatalogs();
+    this.setState({
+      catalogs: catalogs.map(name => ({ label: name, value: name })),
+    });
+  }
+
+  async loadDatabases(catalog?: string) {
+    const databases = await this.props.datasource.getDatabases(catalog);
+    this.setState({
+      databases: databases.map(name => ({ label: name, value: name })),
+    });
+  }
+
+  async loadPreparedStatements() {
+    const statements = await this.props.datasource.getPreparedStatements();
+    this.setState({
+      preparedStatements: statements.map(name => ({ label: name, value: name })),
+    });
   }
 
   async loadNamedQueries() {
@@ -74,6 +163,11 @@ export class QueryEditor extends PureComponent<Props, QueryEditorState> {
     };
   };
 
+  onParametersChange = (parameters: QueryParameter[]) => {
+    const { onChange, query } = this.props;
+    onChange({ ...query, parameters });
+  };
+
   onClickRunQuery = () => {
     this.runQuery();
   };
@@ -93,7 +187,9 @@ export class QueryEditor extends PureComponent<Props, QueryEditorState> {
 
   render() {
     const query = defaults(this.props.query, defaultQuery);
-    const { useCache, timeColumn, valueColumns, metricColumn, executionId } = query;
+    const { useCache, queryString, timeColumn, valueColumns, labelColumns, alias, aggregation, fill, downsample, sortBy, limit, showOther, messageColumn, levelColumn, bucketColumn, countColumn, metricColumn, executionId, catalog, database, preserveDecimals } = query;
+    const parameters = query.parameters || [];
+    const runsSql = [QueryType.NamedQuery, QueryType.RawQuery, QueryType.PreparedStatement, QueryType.Builder].includes(this.state.selectedQueryType.value);
 
     return (
       <div className="gf-form-group">
@@ -123,6 +219,100 @@ export class QueryEditor extends PureComponent<Props, QueryEditorState> {
             />
           </div>
         )}
+        {this.state.selectedQueryType.value === QueryType.Builder && (
+          <QueryBuilderEditor
+            datasource={this.props.datasource}
+            catalog={catalog}
+            database={database}
+            builder={query.builder || { table: '' }}
+            onChange={builder => this.props.onChange({ ...query, builder })}
+          />
+        )}
+        {this.state.selectedQueryType.value === QueryType.PreparedStatement && (
+          <div className="gf-form-inline">
+            <FormLabel width={FIELD_WIDTH}>Prepared Statements</FormLabel>
+            <Select
+              width={FIELD_WIDTH}
+              options={this.state.preparedStatements}
+              value={this.state.preparedStatements.find(p => p.value === query.preparedStatement)}
+              onChange={v => this.props.onChange({ ...query, preparedStatement: v.value })}
+            />
+          </div>
+        )}
+        {this.state.selectedQueryType.value === QueryType.RawQuery && (
+          <div className="gf-form">
+            <textarea
+              className="gf-form-input"
+              rows={5}
+              value={queryString || ''}
+              onChange={e => this.props.onChange({ ...query, queryString: e.target.value })}
+              onBlur={this.onClickRunQuery}
+              placeholder="SELECT ..."
+            />
+          </div>
+        )}
+        {runsSql && (
+          <div className="gf-form-inline">
+            <FormLabel width={FIELD_WIDTH} tooltip="Data catalog the query runs in, the datasource default is used when empty">
+              Catalog
+            </FormLabel>
+            <Select
+              width={FIELD_WIDTH}
+              options={this.state.catalogs}
+              value={catalog ? { label: catalog, value: catalog } : undefined}
+              allowCustomValue
+              isClearable
+              placeholder={this.props.datasource.defaultCatalog || 'AwsDataCatalog'}
+              onChange={v => {
+                const value = (v && v.value) || '';
+                this.props.onChange({ ...query, catalog: value });
+                this.loadDatabases(value);
+              }}
+            />
+            <FormLabel width={FIELD_WIDTH} tooltip="Database the query runs in, the datasource default is used when empty">
+              Database
+            </FormLabel>
+            <Select
+              width={FIELD_WIDTH}
+              options={this.state.databases}
+              value={database ? { label: database, value: database } : undefined}
+              allowCustomValue
+              isClearable
+              placeholder={this.props.datasource.defaultDatabase}
+              onChange={v => this.props.onChange({ ...query, database: (v && v.value) || '' })}
+            />
+          </div>
+        )}
+        {runsSql && this.state.selectedQueryType.value !== QueryType.Builder && (
+          <>
+            {parameters.map((parameter, i) => (
+              <div className="gf-form-inline" key={i}>
+                <FormField
+                  labelWidth={FIELD_WIDTH}
+                  value={parameter.value}
+                  onChange={e => this.onParametersChange(parameters.map((p, j) => (i === j ? { ...p, value: e.target.value } : p)))}
+                  label={`Parameter ${i + 1}`}
+                  placeholder="value, $variable, $__from or $__to"
+                  tooltip="Value of the ? placeholder in this position of the query"
+                ></FormField>
+                <Select
+                  width={FIELD_WIDTH}
+                  options={parameterTypes}
+                  value={parameterTypes.find(t => t.value === parameter.type)}
+                  onChange={v => this.onParametersChange(parameters.map((p, j) => (i === j ? { ...p, type: v.value } : p)))}
+                />
+                <Button variant="secondary" onClick={() => this.onParametersChange(parameters.filter((p, j) => i !== j))}>
+                  Remove
+                </Button>
+              </div>
+            ))}
+            <div className="gf-form">
+              <Button variant="secondary" onClick={() => this.onParametersChange([...parameters, { value: '', type: ParameterType.String }])}>
+                Add Parameter
+              </Button>
+            </div>
+          </>
+        )}
         {this.state.selectedQueryType.value === QueryType.ExecutionQuery && (
           <div className="gf-form">
             <FormField
@@ -167,6 +357,157 @@ export class QueryEditor extends PureComponent<Props, QueryEditorState> {
             ></FormField>
           </div>
         )}
+        {this.state.selectedFormatType.value === FormatType.TimeSeries && (
+          <div className="gf-form">
+            <FormField
+              labelWidth={FIELD_WIDTH}
+              value={labelColumns || ''}
+              onChange={this.onChangeHof('labelColumns')}
+              label="Label Columns"
+              tooltip="Comma separated column names used as series labels. Each distinct label combination becomes its own series"
+            ></FormField>
+          </div>
+        )}
+        {this.state.selectedFormatType.value === FormatType.TimeSeries && (
+          <div className="gf-form">
+            <FormField
+              labelWidth={FIELD_WIDTH}
+              value={alias || ''}
+              onChange={this.onChangeHof('alias')}
+              label="Alias"
+              tooltip="Series name template. Supports {{metric}}, {{column}} and {{<label column>}} placeholders"
+            ></FormField>
+          </div>
+        )}
+        {this.state.selectedFormatType.value === FormatType.TimeSeries && (
+          <div className="gf-form-inline">
+            <FormLabel width={FIELD_WIDTH} tooltip="Merges points of a series sharing the same timestamp">
+              Aggregation
+            </FormLabel>
+            <Select
+              width={FIELD_WIDTH}
+              options={aggregationTypes}
+              value={aggregationTypes.find(a => a.value === aggregation) || aggregationTypes[0]}
+              onChange={v => this.props.onChange({ ...query, aggregation: v.value })}
+            />
+          </div>
+        )}
+        {this.state.selectedFormatType.value === FormatType.TimeSeries && (
+          <div className="gf-form-inline">
+            <FormLabel width={FIELD_WIDTH} tooltip="Inserts points for intervals without data">
+              Fill
+            </FormLabel>
+            <Select
+              width={FIELD_WIDTH}
+              options={fillModes}
+              value={fillModes.find(f => f.value === fill) || fillModes[0]}
+              onChange={v => this.props.onChange({ ...query, fill: v.value })}
+            />
+          </div>
+        )}
+        {this.state.selectedFormatType.value === FormatType.TimeSeries && (
+          <div className="gf-form-inline">
+            <FormLabel width={FIELD_WIDTH} tooltip="Reduces series with more points than the panel max data points">
+              Downsample
+            </FormLabel>
+            <Select
+              width={FIELD_WIDTH}
+              options={downsampleTypes}
+              value={downsampleTypes.find(d => d.value === downsample) || downsampleTypes[0]}
+              onChange={v => this.props.onChange({ ...query, downsample: v.value })}
+            />
+          </div>
+        )}
+        {this.state.selectedFormatType.value === FormatType.TimeSeries && (
+          <div className="gf-form-inline">
+            <FormLabel width={FIELD_WIDTH} tooltip="Series order, value based orders are descending">
+              Sort By
+            </FormLabel>
+            <Select
+              width={FIELD_WIDTH}
+              options={sortTypes}
+              value={sortTypes.find(s => s.value === sortBy) || sortTypes[0]}
+              onChange={v => this.props.onChange({ ...query, sortBy: v.value })}
+            />
+            <FormField
+              labelWidth={FIELD_WIDTH}
+              type="number"
+              value={limit || ''}
+              onChange={this.onChangeHof('limit', true)}
+              label="Limit"
+              tooltip="Keeps the first N series after sorting. 0 keeps all series"
+            ></FormField>
+            <FormLabel width={FIELD_WIDTH} tooltip="Adds a series summing the series beyond the limit">
+              Show Other
+            </FormLabel>
+            <Input type="checkbox" checked={showOther} onChange={this.onChangeHofCheckbox('showOther')} />
+          </div>
+        )}
+        {this.state.selectedFormatType.value === FormatType.Heatmap && (
+          <div className="gf-form">
+            <FormField
+              labelWidth={FIELD_WIDTH}
+              value={timeColumn || ''}
+              onChange={this.onChangeHof('timeColumn')}
+              label="Time Column"
+              tooltip="Column holding the bucket timestamp"
+            ></FormField>
+            <FormField
+              labelWidth={FIELD_WIDTH}
+              value={bucketColumn || ''}
+              onChange={this.onChangeHof('bucketColumn')}
+              label="Bucket Column"
+              tooltip="Column holding the numeric bucket bound"
+            ></FormField>
+            <FormField
+              labelWidth={FIELD_WIDTH}
+              value={countColumn || ''}
+              onChange={this.onChangeHof('countColumn')}
+              label="Count Column"
+              tooltip="Column holding the bucket count"
+            ></FormField>
+          </div>
+        )}
+        {this.state.selectedFormatType.value === FormatType.Logs && (
+          <div className="gf-form">
+            <FormField
+              labelWidth={FIELD_WIDTH}
+              value={timeColumn || ''}
+              onChange={this.onChangeHof('timeColumn')}
+              label="Time Column"
+              tooltip="Column holding the log timestamp"
+            ></FormField>
+            <FormField
+              labelWidth={FIELD_WIDTH}
+              value={messageColumn || ''}
+              onChange={this.onChangeHof('messageColumn')}
+              label="Message Column"
+              tooltip="Column holding the log line"
+            ></FormField>
+            <FormField
+              labelWidth={FIELD_WIDTH}
+              value={levelColumn || ''}
+              onChange={this.onChangeHof('levelColumn')}
+              label="Level Column"
+              tooltip="Optional column holding the log level"
+            ></FormField>
+            <FormField
+              labelWidth={FIELD_WIDTH}
+              value={labelColumns || ''}
+              onChange={this.onChangeHof('labelColumns')}
+              label="Label Columns"
+              tooltip="Comma separated column names kept as labels. Default all remaining columns"
+            ></FormField>
+          </div>
+        )}
+        {this.state.selectedFormatType.value === FormatType.Table && (
+          <div className="gf-form-inline">
+            <FormLabel width={FIELD_WIDTH} tooltip="Keeps decimals beyond float64 precision as exact strings instead of numbers">
+              Preserve Decimals
+            </FormLabel>
+            <Input type="checkbox" checked={preserveDecimals} onChange={this.onChangeHofCheckbox('preserveDecimals')} />
+          </div>
+        )}
 
         <div className="gf-form-inline">
           <FormLabel width={FIELD_WIDTH}>Format</FormLabel>
@@ -0,0 +1,97 @@
+import defaults from 'lodash/defaults';
+
+import React, { PureComponent } from 'react';
+import { FormLabel, Select, Input } from '@grafana/ui';
+import { SelectableValue } from '@grafana/data';
+import { AthenaDataSource } from './DataSource';
+import { AthenaDsQuery, defaultVariableQuery, QueryType } from './types';
+
+interface Props {
+  query: AthenaDsQuery;
+  datasource: AthenaDataSource;
+  onChange: (query: AthenaDsQuery, definition: string) => void;
+}
+
+interface VariableQueryEditorState {
+  namedQueries: SelectableValue[];
+}
+
+const queryTypes = [
+  { label: 'Exec Named Query', value: QueryType.NamedQuery },
+  { label: 'Raw Query', value: QueryType.RawQuery },
+];
+
+const FIELD_WIDTH = 10;
+
+export class AthenaVariableQueryEditor extends PureComponent<Props, VariableQueryEditorState> {
+  state: VariableQueryEditorState = {
+    namedQueries: [],
+  };
+
+  componentDidMount() {
+    this.loadNamedQueries();
+  }
+
+  async loadNamedQueries() {
+    const res = await this.props.datasource.getNamedQueries();
+    this.setState({
+      namedQueries: res as SelectableValue[],
+    });
+  }
+
+  onChange = (changes: Partial<AthenaDsQuery>) => {
+    const query = { ...defaults(this.props.query, defaultVariableQuery), ...changes };
+    const definition = query.queryType === QueryType.NamedQuery ? `Named query: ${query.namedQuery}` : query.queryString || '';
+    this.props.onChange(query, definition);
+  };
+
+  render() {
+    const query = defaults(this.props.query, defaultVariableQuery);
+    const { namedQueries } = this.state;
+
+    return (
+      <div className="gf-form-group">
+        <div className="gf-form-inline">
+          <FormLabel width={FIELD_WIDTH}>Query Type</FormLabel>
+          <Select
+            width={FIELD_WIDTH * 2}
+            options={queryTypes}
+            value={queryTypes.find(q => q.value === query.queryType)}
+            onChange={v => this.onChange({ queryType: v.value })}
+          />
+        </div>
+        {query.queryType === QueryType.NamedQuery && (
+          <div className="gf-form-inline">
+            <FormLabel width={FIELD_WIDTH}>Named Queries</FormLabel>
+            <Select
+              width={FIELD_WIDTH * 2}
+              options={namedQueries}
+              value={namedQueries.find(q => q.value === query.namedQuery)}
+              onChange={v => this.onChange({ namedQuery: v.value })}
+            />
+          </div>
+        )}
+        {query.queryType === QueryType.RawQuery && (
+          <div className="gf-form">
+            <textarea
+              className="gf-form-input"
+              rows={5}
+              defaultValue={query.queryString || ''}
+              onBlur={e => this.onChange({ queryString: e.target.value })}
+              placeholder="SELECT name AS __text, id AS __value FROM ..."
+            />
+          </div>
+        )}
+        <div className="gf-form-inline">
+          <FormLabel
+            width={FIELD_WIDTH}
+            tooltip="Reuse the last execution of the query, keeps dashboard loads fast and cheap"
+          >
+            Use Cache
+          </FormLabel>
+          <Input type="checkbox" checked={query.useCache} onChange={e => this.onChange({ useCache: e.currentTarget.checked })} />
+        </div>
+      </div>
+    );
+  }
+}
@@ -2,8 +2,12 @@ import { DataSourcePlugin } from '@grafana/data';
 import { AthenaDataSource } from './DataSource';
 import { ConfigEditor } from './ConfigEditor';
 import { QueryEditor } from './QueryEditor';
+import { AthenaAnnotationsQueryCtrl } from './AnnotationsQueryCtrl';
+import { AthenaVariableQueryEditor } from './VariableQueryEditor';
 import { AthenaDsQuery, AthenaDsOptions } from './types';
 
 export const plugin = new DataSourcePlugin<AthenaDataSource, AthenaDsQuery, AthenaDsOptions>(AthenaDataSource)
   .setConfigEditor(ConfigEditor)
-  .setQueryEditor(QueryEditor);
+  .setQueryEditor(QueryEditor)
+  .setAnnotationQueryCtrl(AthenaAnnotationsQueryCtrl)
+  .setVariableQueryEditor(AthenaVariableQueryEditor);
@@ -2,13 +2,66 @@ import { DataQuery, DataSourceJsonData } from '@grafana/data';
 export enum QueryType {
   NamedQuery = 'NamedQuery',
   ExecutionQuery = 'ExecutionQuery',
+  RawQuery = 'RawQuery',
   GetNamedQueryMetrics = 'GetNamedQueryMetrics',
-  TestQuery = '',
+  PreparedStatement = 'PreparedStatement',
+  Builder = 'Builder',
+  None = '',
 }
 
 export enum FormatType {
   TimeSeries = 'timeseries',
   Table = 'table',
+  Logs = 'logs',
+  Annotations = 'annotations',
+  Heatmap = 'heatmap',
+  Variable = 'variable',
+}
+
+export enum AggregationType {
+  None = '',
+  Sum = 'sum',
+  Avg = 'avg',
+  Min = 'min',
+  Max = 'max',
+  Last = 'last',
+  Count = 'count',
+}
+
+export enum FillMode {
+  None = '',
+  Null = 'null',
+  Zero = 'zero',
+  Previous = 'previous',
+  Linear = 'linear',
+}
+
+export enum DownsampleType {
+  None = '',
+  Avg = 'avg',
+  Min = 'min',
+  Max = 'max',
+  LTTB = 'lttb',
+}
+
+export enum SortType {
+  Name = 'name',
+  Total = 'total',
+  Max = 'max',
+  Last = 'last',
+}
+
+export enum ParameterType {
+  String = '',
+  Number = 'number',
+  Boolean = 'boolean',
+  Timestamp = 'timestamp',
+  Date = 'date',
+}
+
+export interface QueryParameter {
+  value: string;
+  type: ParameterType;
 }
 
 export enum AuthType {
@@ -18,24 +71,118 @@ export enum AuthType {
 
 export interface AthenaDsQuery extends DataQuery {
   namedQuery?: string;
+  queryString?: string;
   queryType?: QueryType;
   timeColumn?: string;
   metricColumn?: string;
   valueColumns?: string;
+  labelColumns?: string;
+  alias?: string;
   executionId?: string;
   format?: FormatType;
   useCache?: boolean;
+  preserveDecimals?: boolean;
+  aggregation?: AggregationType;
+  fill?: FillMode;
+  downsample?: DownsampleType;
+  sortBy?: SortType;
+  limit?: number;
+  showOther?: boolean;
+  messageColumn?: string;
+  levelColumn?: string;
+  timeEndColumn?: string;
+  titleColumn?: string;
+  textColumn?: string;
+  tagsColumn?: string;
+  bucketColumn?: string;
+  countColumn?: string;
+  catalog?: string;
+  database?: string;
+  variables?: { [name: string]: string[] };
+  parameters?: QueryParameter[];
+  preparedStatement?: string;
+  adhocFilters?: AdhocFilter[];
+  builder?: QueryBuilder;
+}
+
+export interface QueryBuilder {
+  table: string;
+  timeColumn?: string;
+  interval?: string;
+  partitionColumns?: string;
+  columns?: BuilderColumn[];
+  groupBy?: string[];
+  filters?: BuilderFilter[];
+  orderBy?: BuilderOrder[];
+  limit?: number;
+}
+
+export interface BuilderColumn {
+  column: string;
+  aggregation: string;
+  alias?: string;
+}
+
+export interface BuilderFilter {
+  column: string;
+  operator: string;
+  value: string;
+  type?: ParameterType;
+}
+
+export interface BuilderOrder {
+  column: string;
+  desc: boolean;
+}
+
+export interface AdhocFilter {
+  key: string;
+  operator: string;
+  value: string;
 }
 
 export const defaultQuery: Partial<AthenaDsQuery> = {
   namedQuery: '',
-  queryType: QueryType.TestQuery,
+  queryString: '',
+  queryType: QueryType.None,
   timeColumn: 'time',
   metricColumn: 'metric',
   valueColumns: '',
+  labelColumns: '',
+  alias: '',
   executionId: '',
   format: FormatType.TimeSeries,
   useCache: true,
+  preserveDecimals: false,
+  aggregation: AggregationType.None,
+  fill: FillMode.None,
+  downsample: DownsampleType.None,
+  sortBy: SortType.Name,
+  limit: 0,
+  showOther: false,
+  messageColumn: 'message',
+  levelColumn: '',
+  bucketColumn: 'bucket',
+  countColumn: 'count',
+};
+
+export const defaultAnnotationQuery: Partial<AthenaDsQuery> = {
+  queryType: QueryType.NamedQuery,
+  format: FormatType.Annotations,
+  timeColumn: 'time',
+  timeEndColumn: '',
+  titleColumn: 'title',
+  textColumn: 'text',
+  tagsColumn: 'tags',
+  useCache: true,
+};
+
+export const defaultVariableQuery: Partial<AthenaDsQuery> = {
+  queryType: QueryType.RawQuery,
+  format: FormatType.Variable,
+  namedQuery: '',
+  queryString: '',
+  useCache: true,
 };
 
 /**
@@ -47,6 +194,11 @@ export interface AthenaDsOptions extends DataSourceJsonData {
   workGroup: string;
   authType: AuthType;
   roleArn: string;
+  queryTimeout?: number;
+  defaultCatalog?: string;
+  defaultDatabase?: string;
+  maxBytesScanned?: number;
+  pricePerTB?: number;
 }
 
 /**
@@ -59,9 +211,31 @@ export interface AthenaDsSecureJsonData {
 export interface ColumnInfo {
   colName: string;
   colType: RowValueType;
+  typeName: string;
+  precision: number;
+  scale: number;
+  nullable: boolean;
+  isTime: boolean;
 }
+
+export interface TableColumn {
+  name: string;
+  type: string;
+  comment?: string;
+  partition: boolean;
+}
+
 export interface CustomMetadata {
   colInfos: ColumnInfo[];
+  executionId?: string;
+  dataScannedBytes?: number;
+  engineExecutionTimeMs?: number;
+  queryQueueTimeMs?: number;
+  totalExecutionTimeMs?: number;
+  cacheHit?: boolean;
+  estimatedCost?: number;
+  originalCost?: number;
+  query?: string;
 }
 
 export enum RowValueType {